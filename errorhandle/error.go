@@ -2,11 +2,154 @@ package errorhandle
 
 import (
 	"fmt"
+	"strings"
+	"unicode/utf8"
 )
 
-var HadError = false
+type Severity int
 
-func Report(line int, where, msg string) {
-	fmt.Printf("[line \"%d\"] Error %s \": \" %s\n", line, where, msg)
-	HadError = true
-}
\ No newline at end of file
+const (
+	ERROR Severity = iota
+	WARNING
+)
+
+func (s Severity) String() string {
+	switch s {
+	case WARNING:
+		return "Warning"
+	default:
+		return "Error"
+	}
+}
+
+// Stage is the step of a run that found the problem
+type Stage string
+
+const (
+	SCAN    Stage = "scan"
+	PARSE   Stage = "parse"
+	RESOLVE Stage = "resolve"
+	RUNTIME Stage = "runtime"
+)
+
+type Diagnostic struct {
+	Severity   Severity
+	Stage      Stage
+	Line       int // 1-based, 0 when unknown
+	Column     int // 1-based, 0 when unknown
+	Start      int // byte offsets of the offending span in the source
+	End        int
+	Message    string
+	Token      string // lexeme of the offending token, empty at the end of the input
+	SourceLine string // filled in by the reporter, empty if the source isn't known
+}
+
+func (d Diagnostic) String() string {
+	where := "at end"
+	if d.Token != "" {
+		where = "at '" + d.Token + "'"
+	}
+
+	position := fmt.Sprintf("%d", d.Line)
+	if d.Column > 0 {
+		position = fmt.Sprintf("%d:%d", d.Line, d.Column)
+	}
+
+	header := fmt.Sprintf("[line %s] %s %s (%s): %s", position, d.Severity, where, d.Stage, d.Message)
+	if d.SourceLine == "" || d.Column == 0 {
+		return header
+	}
+	return header + "\n" + d.SourceLine + "\n" + d.underline()
+}
+
+// underline puts a ^~~~ under the span, tabs are kept so it lines up with the source line above.
+// Column counts characters, not bytes, so the line is walked rune by rune
+func (d Diagnostic) underline() string {
+	var b strings.Builder
+	line := []rune(d.SourceLine)
+	prefix := line
+	if d.Column-1 < len(line) {
+		prefix = line[:d.Column-1]
+	}
+	for _, c := range prefix {
+		if c == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+	}
+
+	// count the characters of the span, a span running past the end of the line is cut there
+	width, bytes := 0, d.End-d.Start
+	for _, c := range line[len(prefix):] {
+		if bytes <= 0 {
+			break
+		}
+		bytes -= utf8.RuneLen(c)
+		width++
+	}
+
+	b.WriteString("^")
+	if width > 1 {
+		b.WriteString(strings.Repeat("~", width-1))
+	}
+	return b.String()
+}
+
+// Diagnostics is what a run returns as its error
+type Diagnostics []Diagnostic
+
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i, diagnostic := range d {
+		lines[i] = diagnostic.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Reporter collects the diagnostics of a single run, every stage writes to the same one
+type Reporter struct {
+	source      string
+	diagnostics Diagnostics
+}
+
+func NewReporter(source string) *Reporter {
+	return &Reporter{source: source}
+}
+
+func (r *Reporter) Report(d Diagnostic) {
+	if d.SourceLine == "" {
+		d.SourceLine = r.line(d.Line)
+	}
+	r.diagnostics = append(r.diagnostics, d)
+}
+
+// line returns the nth (1-based) line of the source, without the line break
+func (r *Reporter) line(n int) string {
+	lines := strings.Split(r.source, "\n")
+	if n < 1 || n > len(lines) {
+		return ""
+	}
+	return strings.TrimRight(lines[n-1], "\r")
+}
+
+func (r *Reporter) Diagnostics() Diagnostics {
+	return r.diagnostics
+}
+
+func (r *Reporter) HadError() bool {
+	for _, d := range r.diagnostics {
+		if d.Severity == ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+// Err returns the collected diagnostics as an error, or nil if there is no error among them
+func (r *Reporter) Err() error {
+	if !r.HadError() {
+		return nil
+	}
+	return r.diagnostics
+}
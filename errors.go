@@ -0,0 +1,83 @@
+package main
+
+import (
+	"dexianta/glox/errorhandle"
+	"dexianta/glox/interpreter"
+	"errors"
+)
+
+// exit codes follow sysexits.h
+const (
+	exitUsage    = 64 // EX_USAGE
+	exitDataErr  = 65 // EX_DATAERR, the script doesn't compile
+	exitSoftware = 70 // EX_SOFTWARE, the script failed while running
+	exitIOErr    = 74 // EX_IOERR
+)
+
+// ScanError is returned by run when the source can't be tokenized
+type ScanError struct {
+	errorhandle.Diagnostics
+}
+
+// ParseError is returned by run when the source has syntax errors
+type ParseError struct {
+	errorhandle.Diagnostics
+}
+
+// ResolveError is returned by run when the resolver finds static errors
+type ResolveError struct {
+	errorhandle.Diagnostics
+}
+
+// RuntimeError is returned by run when the script fails while it's being interpreted,
+// the interpreter's own error can be reached with errors.As
+type RuntimeError struct {
+	errorhandle.Diagnostics
+	Cause error
+}
+
+// maxTraceFrames caps the traceback, deep recursion would drown the actual error
+const maxTraceFrames = 20
+
+func (r RuntimeError) Error() string {
+	var runtimeErr interpreter.RuntimeError
+	if errors.As(r.Cause, &runtimeErr) && len(runtimeErr.Stack) != 0 {
+		return runtimeErr.Traceback(maxTraceFrames) + r.Diagnostics.Error()
+	}
+	return r.Diagnostics.Error()
+}
+
+func (r RuntimeError) Unwrap() error {
+	return r.Cause
+}
+
+// IOError is returned when the script or the prompt can't be read
+type IOError struct {
+	Err error
+}
+
+func (i IOError) Error() string {
+	return i.Err.Error()
+}
+
+func (i IOError) Unwrap() error {
+	return i.Err
+}
+
+func exitCode(err error) int {
+	var scanErr ScanError
+	var parseErr ParseError
+	var resolveErr ResolveError
+	var ioErr IOError
+
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &scanErr), errors.As(err, &parseErr), errors.As(err, &resolveErr):
+		return exitDataErr
+	case errors.As(err, &ioErr):
+		return exitIOErr
+	default:
+		return exitSoftware
+	}
+}
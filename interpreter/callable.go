@@ -0,0 +1,74 @@
+package interpreter
+
+import (
+	"dexianta/glox/parser"
+)
+
+// LoxCallable is anything that can be called from lox code, user functions and natives alike
+type LoxCallable interface {
+	Arity() int
+	Call(i *Interpreter, args []Value) (Value, error)
+}
+
+// ========================= //
+
+type LoxFunction struct {
+	declaration   parser.Function
+	closure       *Environment
+	isInitializer bool // init always returns this
+}
+
+func NewLoxFunction(declaration parser.Function, closure *Environment, isInitializer bool) *LoxFunction {
+	return &LoxFunction{
+		declaration:   declaration,
+		closure:       closure,
+		isInitializer: isInitializer,
+	}
+}
+
+// Bind returns a copy of the method with this set to the instance
+func (f *LoxFunction) Bind(instance *LoxInstance) *LoxFunction {
+	env := NewEnvironment(f.closure)
+	env.Define("this", instance)
+	return NewLoxFunction(f.declaration, env, f.isInitializer)
+}
+
+func (f *LoxFunction) Arity() int {
+	return len(f.declaration.Params)
+}
+
+func (f *LoxFunction) Call(i *Interpreter, args []interface{}) (interface{}, error) {
+	env := NewEnvironment(f.closure)
+	for idx, param := range f.declaration.Params {
+		env.Define(param.Lexeme, args[idx])
+	}
+
+	var value interface{}
+	err := i.executeBlock(f.declaration.Body, env)
+	if ret, ok := err.(returnValue); ok {
+		value = ret.value
+	} else if err != nil {
+		return nil, err
+	}
+
+	if f.isInitializer {
+		return f.closure.GetAt(0, "this"), nil
+	}
+	return value, nil
+}
+
+func (f *LoxFunction) String() string {
+	return "<fn " + f.declaration.Name.Lexeme + ">"
+}
+
+// ========================= //
+
+// returnValue unwinds the go stack from a return statement back to the call,
+// it travels as an error so every statement in between stops executing
+type returnValue struct {
+	value interface{}
+}
+
+func (r returnValue) Error() string {
+	return "return outside of function"
+}
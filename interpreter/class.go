@@ -0,0 +1,103 @@
+package interpreter
+
+import (
+	"dexianta/glox/scanner"
+)
+
+// LoxClass is callable, calling it creates a new instance
+type LoxClass struct {
+	Name       string
+	superclass *LoxClass
+	methods    map[string]*LoxFunction
+}
+
+func NewLoxClass(name string, superclass *LoxClass, methods map[string]*LoxFunction) *LoxClass {
+	return &LoxClass{
+		Name:       name,
+		superclass: superclass,
+		methods:    methods,
+	}
+}
+
+// FindMethod walks up the inheritance chain until the method is found
+func (c *LoxClass) FindMethod(name string) (*LoxFunction, bool) {
+	if method, ok := c.methods[name]; ok {
+		return method, true
+	}
+
+	if c.superclass != nil {
+		return c.superclass.FindMethod(name)
+	}
+	return nil, false
+}
+
+// methodNames lists the methods of the class, inherited ones included
+func (c *LoxClass) methodNames() []string {
+	var names []string
+	for class := c; class != nil; class = class.superclass {
+		for name := range class.methods {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (c *LoxClass) Arity() int {
+	if initializer, ok := c.FindMethod("init"); ok {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *LoxClass) Call(i *Interpreter, args []interface{}) (interface{}, error) {
+	instance := NewLoxInstance(c)
+	if initializer, ok := c.FindMethod("init"); ok {
+		if _, err := initializer.Bind(instance).Call(i, args); err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+func (c *LoxClass) String() string {
+	return c.Name
+}
+
+// ========================= //
+
+type LoxInstance struct {
+	class  *LoxClass
+	fields map[string]interface{}
+}
+
+func NewLoxInstance(class *LoxClass) *LoxInstance {
+	return &LoxInstance{
+		class:  class,
+		fields: map[string]interface{}{},
+	}
+}
+
+// Get looks at the fields first, so a field shadows a method with the same name
+func (l *LoxInstance) Get(name scanner.Token) (interface{}, error) {
+	if value, ok := l.fields[name.Lexeme]; ok {
+		return value, nil
+	}
+
+	if method, ok := l.class.FindMethod(name.Lexeme); ok {
+		return method.Bind(l), nil
+	}
+
+	names := l.class.methodNames()
+	for field := range l.fields {
+		names = append(names, field)
+	}
+	return nil, undefined("property", name, names)
+}
+
+func (l *LoxInstance) Set(name scanner.Token, value interface{}) {
+	l.fields[name.Lexeme] = value
+}
+
+func (l *LoxInstance) String() string {
+	return l.class.Name + " instance"
+}
@@ -0,0 +1,75 @@
+package interpreter
+
+import (
+	"dexianta/glox/scanner"
+)
+
+// Environment holds the variables of one scope, and links to the enclosing one
+type Environment struct {
+	enclosing *Environment
+	values    map[string]interface{}
+}
+
+func NewEnvironment(enclosing *Environment) *Environment {
+	return &Environment{
+		enclosing: enclosing,
+		values:    map[string]interface{}{},
+	}
+}
+
+func (e *Environment) Define(name string, value interface{}) {
+	e.values[name] = value
+}
+
+func (e *Environment) Get(name scanner.Token) (interface{}, error) {
+	if value, ok := e.values[name.Lexeme]; ok {
+		return value, nil
+	}
+
+	if e.enclosing != nil {
+		return e.enclosing.Get(name)
+	}
+
+	return nil, undefined("variable", name, e.Names())
+}
+
+func (e *Environment) Assign(name scanner.Token, value interface{}) error {
+	if _, ok := e.values[name.Lexeme]; ok {
+		e.values[name.Lexeme] = value
+		return nil
+	}
+
+	if e.enclosing != nil {
+		return e.enclosing.Assign(name, value)
+	}
+
+	return undefined("variable", name, e.Names())
+}
+
+func (e *Environment) ancestor(distance int) *Environment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
+}
+
+// GetAt reads a variable the resolver has already found, so it must exist
+func (e *Environment) GetAt(distance int, name string) interface{} {
+	return e.ancestor(distance).values[name]
+}
+
+func (e *Environment) AssignAt(distance int, name scanner.Token, value interface{}) {
+	e.ancestor(distance).values[name.Lexeme] = value
+}
+
+// Names lists every variable visible from this scope
+func (e *Environment) Names() []string {
+	var names []string
+	for env := e; env != nil; env = env.enclosing {
+		for name := range env.values {
+			names = append(names, name)
+		}
+	}
+	return names
+}
@@ -1,15 +1,102 @@
 package interpreter
 
 import (
+   "dexianta/glox/errorhandle"
    "dexianta/glox/scanner"
+   "dexianta/glox/utils"
    "fmt"
+   "strings"
 )
 
 type RuntimeError struct {
-   Token scanner.Token
-   Msg string
+   Token      scanner.Token
+   Msg        string
+   Suggestion string  // a similar name that is defined, for undefined names
+   Stack      []Frame // outermost call first, filled in once the error leaves the innermost call
+   Thrown     bool    // raised by a throw statement, Value holds what was thrown
+   Value      Value
+}
+
+// errorClass is the class of the objects a catch clause gets for errors raised by the interpreter
+var errorClass = NewLoxClass("Error", nil, map[string]*LoxFunction{})
+
+// catchValue is what a catch clause binds its variable to
+func (r RuntimeError) catchValue() Value {
+   if r.Thrown {
+      return r.Value
+   }
+
+   instance := NewLoxInstance(errorClass)
+   instance.fields["message"] = r.message()
+   instance.fields["line"] = int64(r.Token.Line)
+   return instance
+}
+
+// undefined builds the error for a name lookup that failed, suggesting the closest of the defined names
+func undefined(kind string, name scanner.Token, defined []string) RuntimeError {
+   suggestion, _ := utils.Suggest(name.Lexeme, defined)
+   return RuntimeError{
+      Token:      name,
+      Msg:        fmt.Sprintf("Undefined %s '%s'", kind, name.Lexeme),
+      Suggestion: suggestion,
+   }
+}
+
+func (r RuntimeError) message() string {
+   if r.Suggestion == "" {
+      return r.Msg
+   }
+   return fmt.Sprintf("%s, did you mean '%s'?", r.Msg, r.Suggestion)
+}
+
+// Frame is one entry of the lox call stack, Line is the line that was running in it
+type Frame struct {
+   Function string
+   File     string
+   Line     int
+}
+
+func (f Frame) String() string {
+   return fmt.Sprintf("%s:%d in %s", f.File, f.Line, f.Function)
+}
+
+// Traceback prints the stack with the most recent call last, if there are more than
+// max frames, the ones in the middle are left out
+func (r RuntimeError) Traceback(max int) string {
+   var b strings.Builder
+   b.WriteString("Traceback (most recent call last):\n")
+
+   frames := r.Stack
+   omitted := 0
+   if max > 0 && len(frames) > max {
+      omitted = len(frames) - max
+   }
+
+   for idx, frame := range frames {
+      if omitted > 0 && idx == max/2 {
+         fmt.Fprintf(&b, "  ... %d frames omitted\n", omitted)
+      }
+      if omitted > 0 && idx >= max/2 && idx < max/2+omitted {
+         continue
+      }
+      fmt.Fprintf(&b, "  %s\n", frame)
+   }
+   return b.String()
 }
 
 func (r RuntimeError) Error() string {
-   return fmt.Sprintf("%v: %s\n", r.Token, r.Msg)
+   return fmt.Sprintf("[line %d] at '%s': %s", r.Token.Line, r.Token.Lexeme, r.message())
+}
+
+func (r RuntimeError) Diagnostic() errorhandle.Diagnostic {
+   return errorhandle.Diagnostic{
+      Severity: errorhandle.ERROR,
+      Stage:    errorhandle.RUNTIME,
+      Line:     r.Token.Line,
+      Column:   r.Token.Column,
+      Start:    r.Token.Start,
+      End:      r.Token.End,
+      Message:  r.message(),
+      Token:    r.Token.Lexeme,
+   }
 }
@@ -4,64 +4,387 @@ import (
 	"dexianta/glox/parser"
 	"dexianta/glox/scanner"
 	"fmt"
-	"reflect"
+	"math"
+	"strconv"
+	"strings"
 )
 
-func Interpret(expr parser.Expr) (res interface{}, err error) {
+// maxCallDepth keeps runaway recursion from blowing the go stack
+const maxCallDepth = 10000
+
+type Interpreter struct {
+	globals     *Environment
+	environment *Environment
+	locals      map[parser.Expr]int // resolved scope depth of local variables
+	file        string
+	calls       []activation // the functions being run right now, natives too
+
+	// registered operators, the table is for the scanner and parser
+	// and the natives are what they evaluate to
+	operators     *parser.Operators
+	binaryNatives map[scanner.TokenType]*NativeFunction
+	prefixNatives map[scanner.TokenType]*NativeFunction
+}
+
+// activation is a live entry of the call stack
+type activation struct {
+	function string
+	line     int // the line of the call site, in the caller
+}
+
+func NewInterpreter() *Interpreter {
+	globals := NewEnvironment(nil)
+	i := &Interpreter{
+		globals:     globals,
+		environment: globals,
+		locals:      map[parser.Expr]int{},
+
+		operators:     parser.NewOperators(),
+		binaryNatives: map[scanner.TokenType]*NativeFunction{},
+		prefixNatives: map[scanner.TokenType]*NativeFunction{},
+	}
+	i.registerBuiltins()
+	return i
+}
+
+// SetFile names the script in stack traces
+func (i *Interpreter) SetFile(file string) {
+	i.file = file
+}
+
+func (i *Interpreter) Interpret(stmts []parser.Stmt) error {
+	for _, stmt := range stmts {
+		if err := i.Execute(stmt); err != nil {
+			return i.withStack(err)
+		}
+	}
+	return nil
+}
+
+// withStack records the call stack on a runtime error, it has to be called
+// before the call the error was raised in is popped
+func (i *Interpreter) withStack(err error) error {
+	runtimeErr, ok := err.(RuntimeError)
+	if !ok || runtimeErr.Stack != nil {
+		return err
+	}
+
+	file := i.file
+	if file == "" {
+		file = "<script>"
+	}
+
+	function := "<script>"
+	for _, c := range i.calls {
+		runtimeErr.Stack = append(runtimeErr.Stack, Frame{Function: function, File: file, Line: c.line})
+		function = c.function
+	}
+	runtimeErr.Stack = append(runtimeErr.Stack, Frame{Function: function, File: file, Line: runtimeErr.Token.Line})
+	return runtimeErr
+}
+
+func (i *Interpreter) Execute(stmt parser.Stmt) error {
+	switch stmt.(type) {
+	case parser.Expression:
+		return i.ExpressionStmt(stmt.(parser.Expression))
+	case parser.Print:
+		return i.PrintStmt(stmt.(parser.Print))
+	case parser.Var:
+		return i.VarStmt(stmt.(parser.Var))
+	case parser.Block:
+		return i.BlockStmt(stmt.(parser.Block))
+	case parser.If:
+		return i.IfStmt(stmt.(parser.If))
+	case parser.While:
+		return i.WhileStmt(stmt.(parser.While))
+	case parser.Function:
+		return i.FunctionStmt(stmt.(parser.Function))
+	case parser.Return:
+		return i.ReturnStmt(stmt.(parser.Return))
+	case parser.Class:
+		return i.ClassStmt(stmt.(parser.Class))
+	case parser.Throw:
+		return i.ThrowStmt(stmt.(parser.Throw))
+	case parser.Try:
+		return i.TryStmt(stmt.(parser.Try))
+	default:
+		return RuntimeError{Msg: "invalid stmt"}
+	}
+}
+
+func (i *Interpreter) ExpressionStmt(stmt parser.Expression) error {
+	_, err := i.Evaluate(stmt.Expression)
+	return err
+}
+
+func (i *Interpreter) PrintStmt(stmt parser.Print) error {
+	value, err := i.Evaluate(stmt.Expression)
+	if err != nil {
+		return err
+	}
+	fmt.Println(Stringify(value))
+	return nil
+}
+
+func (i *Interpreter) VarStmt(stmt parser.Var) error {
+	var value interface{}
+	if stmt.Initializer != nil {
+		var err error
+		value, err = i.Evaluate(stmt.Initializer)
+		if err != nil {
+			return err
+		}
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, value)
+	return nil
+}
+
+func (i *Interpreter) BlockStmt(stmt parser.Block) error {
+	return i.executeBlock(stmt.Statements, NewEnvironment(i.environment))
+}
+
+func (i *Interpreter) IfStmt(stmt parser.If) error {
+	condition, err := i.Evaluate(stmt.Condition)
+	if err != nil {
+		return err
+	}
+
+	if isTruthy(condition) {
+		return i.Execute(stmt.ThenBranch)
+	} else if stmt.ElseBranch != nil {
+		return i.Execute(stmt.ElseBranch)
+	}
+	return nil
+}
+
+func (i *Interpreter) WhileStmt(stmt parser.While) error {
+	for {
+		condition, err := i.Evaluate(stmt.Condition)
+		if err != nil {
+			return err
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if err := i.Execute(stmt.Body); err != nil {
+			return err
+		}
+	}
+}
+
+func (i *Interpreter) FunctionStmt(stmt parser.Function) error {
+	i.environment.Define(stmt.Name.Lexeme, NewLoxFunction(stmt, i.environment, false))
+	return nil
+}
+
+func (i *Interpreter) ClassStmt(stmt parser.Class) error {
+	var superclass *LoxClass
+	if stmt.Superclass != nil {
+		value, err := i.Evaluate(stmt.Superclass)
+		if err != nil {
+			return err
+		}
+		class, ok := value.(*LoxClass)
+		if !ok {
+			return RuntimeError{Token: stmt.Superclass.Name, Msg: "Superclass must be a class"}
+		}
+		superclass = class
+	}
+
+	i.environment.Define(stmt.Name.Lexeme, nil)
+
+	// methods close over an extra scope that holds super
+	env := i.environment
+	if superclass != nil {
+		env = NewEnvironment(env)
+		env.Define("super", superclass)
+	}
+
+	methods := map[string]*LoxFunction{}
+	for _, method := range stmt.Methods {
+		methods[method.Name.Lexeme] = NewLoxFunction(method, env, method.Name.Lexeme == "init")
+	}
+
+	return i.environment.Assign(stmt.Name, NewLoxClass(stmt.Name.Lexeme, superclass, methods))
+}
+
+func (i *Interpreter) ReturnStmt(stmt parser.Return) error {
+	var value interface{}
+	if stmt.Value != nil {
+		var err error
+		if value, err = i.Evaluate(stmt.Value); err != nil {
+			return err
+		}
+	}
+	return returnValue{value}
+}
+
+func (i *Interpreter) ThrowStmt(stmt parser.Throw) error {
+	value, err := i.Evaluate(stmt.Value)
+	if err != nil {
+		return err
+	}
+
+	msg := Stringify(value)
+	if instance, ok := value.(*LoxInstance); ok {
+		if message, ok := instance.fields["message"]; ok {
+			msg = Stringify(message)
+		}
+	}
+	return RuntimeError{Token: stmt.Keyword, Msg: "Uncaught exception: " + msg, Thrown: true, Value: value}
+}
+
+// TryStmt only catches runtime errors, a return passes through the catch but still runs finally
+func (i *Interpreter) TryStmt(stmt parser.Try) error {
+	err := i.executeBlock(stmt.Body, NewEnvironment(i.environment))
+
+	if runtimeErr, ok := err.(RuntimeError); ok && stmt.CatchName != nil {
+		env := NewEnvironment(i.environment)
+		env.Define(stmt.CatchName.Lexeme, runtimeErr.catchValue())
+		err = i.executeBlock(stmt.Catch, env)
+	}
+
+	if stmt.Finally != nil {
+		// an error or a return from finally wins over the pending one
+		if finallyErr := i.executeBlock(stmt.Finally, NewEnvironment(i.environment)); finallyErr != nil {
+			return finallyErr
+		}
+	}
+	return err
+}
+
+func (i *Interpreter) executeBlock(stmts []parser.Stmt, env *Environment) error {
+	previous := i.environment
+	i.environment = env
+	defer func() { i.environment = previous }()
+
+	for _, stmt := range stmts {
+		if err := i.Execute(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) Evaluate(expr parser.Expr) (res interface{}, err error) {
 	switch expr.(type) {
 	case parser.Binary:
-		res, err = BinaryExpr(expr.(parser.Binary))
+		res, err = i.BinaryExpr(expr.(parser.Binary))
 	case parser.Unary:
-		res, err = UnaryExpr(expr.(parser.Unary))
+		res, err = i.UnaryExpr(expr.(parser.Unary))
 	case parser.Grouping:
-		res, err = GroupingExpr(expr.(parser.Grouping))
+		res, err = i.GroupingExpr(expr.(parser.Grouping))
 	case parser.Literal:
-		res, err = LiteralExpr(expr.(parser.Literal))
+		res, err = i.LiteralExpr(expr.(parser.Literal))
+	case *parser.Variable:
+		res, err = i.VariableExpr(expr.(*parser.Variable))
+	case *parser.Assign:
+		res, err = i.AssignExpr(expr.(*parser.Assign))
+	case parser.Logical:
+		res, err = i.LogicalExpr(expr.(parser.Logical))
+	case parser.Lambda:
+		res, err = i.LambdaExpr(expr.(parser.Lambda))
+	case parser.Update:
+		res, err = i.UpdateExpr(expr.(parser.Update))
+	case parser.Conditional:
+		res, err = i.ConditionalExpr(expr.(parser.Conditional))
+	case parser.Interpolation:
+		res, err = i.InterpolationExpr(expr.(parser.Interpolation))
+	case parser.Call:
+		res, err = i.CallExpr(expr.(parser.Call))
+	case parser.Get:
+		res, err = i.GetExpr(expr.(parser.Get))
+	case parser.Set:
+		res, err = i.SetExpr(expr.(parser.Set))
+	case *parser.This:
+		res, err = i.ThisExpr(expr.(*parser.This))
+	case *parser.Super:
+		res, err = i.SuperExpr(expr.(*parser.Super))
 	default:
 		err = RuntimeError{Msg: "invalid expr"}
 	}
 
-	if err != nil {
-		fmt.Println(err)
-	}
 	return res, err
 }
 
-func BinaryExpr(binary parser.Binary) (interface{}, error) {
-	left, err := Interpret(binary.Left)
+func (i *Interpreter) BinaryExpr(binary parser.Binary) (interface{}, error) {
+	left, err := i.Evaluate(binary.Left)
 	if err != nil {
 		return nil, err
 	}
-	right, err := Interpret(binary.Right)
+	right, err := i.Evaluate(binary.Right)
 	if err != nil {
 		return nil, err
 	}
+	if native, ok := i.binaryNatives[binary.Operator.Type]; ok {
+		return i.callOperator(native, binary.Operator, left, right)
+	}
+	return binaryOp(binary.Operator, left, right)
+}
 
-	op := binary.Operator
+// binaryOp applies an operator to operands that are already evaluated
+func binaryOp(op scanner.Token, left, right interface{}) (interface{}, error) {
 	switch op.Type {
 	case scanner.MINUS:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) - right.(float64), nil
+		if a, b, ok := integers(left, right); ok {
+			return checkOverflow(op, a-b, (a-b < a) == (b > 0))
+		}
+		return toFloat(left) - toFloat(right), nil
 	case scanner.SLASH:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) / right.(float64), nil
+		// "/" always divides exactly, "~/" is the one that stays an integer
+		return toFloat(left) / toFloat(right), nil
+	case scanner.TILDE_SLASH:
+		err := checkNumberOperands(op, right, left)
+		if err != nil {
+			return nil, err
+		}
+		if a, b, ok := integers(left, right); ok {
+			if b == 0 {
+				return nil, RuntimeError{Token: op, Msg: "integer division by zero"}
+			}
+			return checkOverflow(op, a/b, a != math.MinInt64 || b != -1)
+		}
+		return math.Trunc(toFloat(left) / toFloat(right)), nil
+	case scanner.PERCENT:
+		err := checkNumberOperands(op, right, left)
+		if err != nil {
+			return nil, err
+		}
+		if a, b, ok := integers(left, right); ok {
+			if b == 0 {
+				return nil, RuntimeError{Token: op, Msg: "integer division by zero"}
+			}
+			return a % b, nil
+		}
+		return math.Mod(toFloat(left), toFloat(right)), nil
 	case scanner.STAR:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) * right.(float64), nil
+		if a, b, ok := integers(left, right); ok {
+			// the product divided back doesn't give the operand when it wrapped,
+			// except for -1 * MinInt64 since that division wraps the same way
+			fits := a == 0 || (a*b/a == b && !(a == -1 && b == math.MinInt64))
+			return checkOverflow(op, a*b, fits)
+		}
+		return toFloat(left) * toFloat(right), nil
 	case scanner.PLUS:
-		n1, ok1 := left.(float64)
-		n2, ok2 := right.(float64)
-		if ok1 && ok2 {
-			return n1 + n2, nil
+		if isNumber(left) && isNumber(right) {
+			if a, b, ok := integers(left, right); ok {
+				return checkOverflow(op, a+b, (a+b > a) == (b > 0))
+			}
+			return toFloat(left) + toFloat(right), nil
 		}
 
 		s1, ok1 := left.(string)
@@ -69,30 +392,49 @@ func BinaryExpr(binary parser.Binary) (interface{}, error) {
 		if ok1 && ok2 {
 			return s1 + s2, nil
 		}
+
+		return nil, RuntimeError{
+			Token: op,
+			Msg:   "operands must be two numbers or two strings",
+		}
 	case scanner.GREATER:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) > right.(float64), nil
+		if a, b, ok := integers(left, right); ok {
+			return a > b, nil
+		}
+		return toFloat(left) > toFloat(right), nil
 	case scanner.GREATER_EQUAL:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) >= right.(float64), nil
+		if a, b, ok := integers(left, right); ok {
+			return a >= b, nil
+		}
+		return toFloat(left) >= toFloat(right), nil
 	case scanner.LESS:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) < right.(float64), nil
+		if a, b, ok := integers(left, right); ok {
+			return a < b, nil
+		}
+		return toFloat(left) < toFloat(right), nil
 	case scanner.LESS_EQUAL:
 		err := checkNumberOperands(op, right, left)
 		if err != nil {
 			return nil, err
 		}
-		return left.(float64) <= right.(float64), nil
+		if a, b, ok := integers(left, right); ok {
+			return a <= b, nil
+		}
+		return toFloat(left) <= toFloat(right), nil
+	case scanner.COMMA:
+		return right, nil
 	case scanner.BANG_EQUAL:
 		return !isEqual(left, right), nil
 	case scanner.EQUAL_EQUAL:
@@ -103,40 +445,308 @@ func BinaryExpr(binary parser.Binary) (interface{}, error) {
 			Msg:   "didn't match any operator",
 		}
 	}
-	return nil, RuntimeError{
-		Token: op,
-		Msg:   "not sure what's wrong",
+}
+
+// LambdaExpr closes over the environment it's evaluated in, like a function declaration
+func (i *Interpreter) LambdaExpr(lambda parser.Lambda) (interface{}, error) {
+	return NewLoxFunction(lambda.Function, i.environment, false), nil
+}
+
+// ConditionalExpr only evaluates the branch it picks
+func (i *Interpreter) ConditionalExpr(conditional parser.Conditional) (interface{}, error) {
+	condition, err := i.Evaluate(conditional.Condition)
+	if err != nil {
+		return nil, err
+	}
+	if isTruthy(condition) {
+		return i.Evaluate(conditional.ThenBranch)
+	}
+	return i.Evaluate(conditional.ElseBranch)
+}
+
+// LogicalExpr short-circuits, and returns the operand that decided the result
+func (i *Interpreter) LogicalExpr(logical parser.Logical) (interface{}, error) {
+	left, err := i.Evaluate(logical.Left)
+	if err != nil {
+		return nil, err
+	}
+
+	if logical.Operator.Type == scanner.OR {
+		if isTruthy(left) {
+			return left, nil
+		}
+	} else {
+		if !isTruthy(left) {
+			return left, nil
+		}
+	}
+
+	return i.Evaluate(logical.Right)
+}
+
+func (i *Interpreter) CallExpr(call parser.Call) (interface{}, error) {
+	callee, err := i.Evaluate(call.Callee)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []interface{}
+	for _, arg := range call.Arguments {
+		value, err := i.Evaluate(arg)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, value)
+	}
+
+	function, ok := callee.(LoxCallable)
+	if !ok {
+		return nil, RuntimeError{Token: call.Paren, Msg: "Can only call functions and classes"}
+	}
+	if len(args) != function.Arity() {
+		return nil, RuntimeError{
+			Token: call.Paren,
+			Msg:   fmt.Sprintf("Expected %d arguments but got %d", function.Arity(), len(args)),
+		}
+	}
+
+	if len(i.calls) >= maxCallDepth {
+		return nil, RuntimeError{Token: call.Paren, Msg: "Stack overflow"}
+	}
+	i.calls = append(i.calls, callFrame(function, call.Paren.Line))
+	defer func() { i.calls = i.calls[:len(i.calls)-1] }()
+
+	res, err := function.Call(i, args)
+	if _, ok := err.(RuntimeError); err != nil && !ok {
+		if _, native := function.(*NativeFunction); native {
+			// a native has no source of its own, its error is reported at the call
+			err = RuntimeError{Token: call.Paren, Msg: err.Error()}
+		}
+	}
+	if err != nil {
+		return nil, i.withStack(err)
+	}
+	return res, nil
+}
+
+func callFrame(function LoxCallable, line int) activation {
+	switch f := function.(type) {
+	case *LoxFunction:
+		return activation{function: f.declaration.Name.Lexeme, line: line}
+	case *LoxClass:
+		return activation{function: f.Name + ".init", line: line}
+	case *NativeFunction:
+		return activation{function: f.name, line: line}
+	default:
+		return activation{function: "<fn>", line: line}
+	}
+}
+
+func (i *Interpreter) GetExpr(get parser.Get) (interface{}, error) {
+	object, err := i.Evaluate(get.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance, ok := object.(*LoxInstance); ok {
+		return instance.Get(get.Name)
+	}
+	return nil, RuntimeError{Token: get.Name, Msg: "Only instances have properties"}
+}
+
+func (i *Interpreter) SetExpr(set parser.Set) (interface{}, error) {
+	object, err := i.Evaluate(set.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, ok := object.(*LoxInstance)
+	if !ok {
+		return nil, RuntimeError{Token: set.Name, Msg: "Only instances have fields"}
+	}
+
+	value, err := i.Evaluate(set.Value)
+	if err != nil {
+		return nil, err
+	}
+	instance.Set(set.Name, value)
+	return value, nil
+}
+
+func (i *Interpreter) ThisExpr(this *parser.This) (interface{}, error) {
+	return i.lookUpVariable(this.Keyword, this)
+}
+
+// SuperExpr finds the method on the superclass, and binds it to the current instance,
+// which lives in the scope right inside the one holding super
+func (i *Interpreter) SuperExpr(super *parser.Super) (interface{}, error) {
+	distance := i.locals[super]
+	superclass := i.environment.GetAt(distance, "super").(*LoxClass)
+	instance := i.environment.GetAt(distance-1, "this").(*LoxInstance)
+
+	method, ok := superclass.FindMethod(super.Method.Lexeme)
+	if !ok {
+		return nil, undefined("property", super.Method, superclass.methodNames())
 	}
+	return method.Bind(instance), nil
 }
 
-func GroupingExpr(grouping parser.Grouping) (interface{}, error) {
-	return Interpret(grouping.Expression)
+func (i *Interpreter) InterpolationExpr(interpolation parser.Interpolation) (interface{}, error) {
+	var b strings.Builder
+	for _, part := range interpolation.Parts {
+		value, err := i.Evaluate(part)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(Stringify(value))
+	}
+	return b.String(), nil
+}
+
+func (i *Interpreter) GroupingExpr(grouping parser.Grouping) (interface{}, error) {
+	return i.Evaluate(grouping.Expression)
 }
 
-func LiteralExpr(literal parser.Literal) (interface{}, error) {
+func (i *Interpreter) LiteralExpr(literal parser.Literal) (interface{}, error) {
 	return literal.Value, nil
 }
 
-func UnaryExpr(u parser.Unary) (interface{}, error) {
-	right, err := Interpret(u.Right)
+func (i *Interpreter) VariableExpr(v *parser.Variable) (interface{}, error) {
+	return i.lookUpVariable(v.Name, v)
+}
+
+func (i *Interpreter) AssignExpr(a *parser.Assign) (interface{}, error) {
+	value, err := i.Evaluate(a.Value)
 	if err != nil {
 		return nil, err
 	}
+
+	if err := i.assignVariable(a.Name, a, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// assignVariable is the write side of lookUpVariable
+func (i *Interpreter) assignVariable(name scanner.Token, expr parser.Expr, value interface{}) error {
+	if distance, ok := i.locals[expr]; ok {
+		i.environment.AssignAt(distance, name, value)
+		return nil
+	}
+
+	if err := i.globals.Assign(name, value); err != nil {
+		return undefined("variable", name, i.environment.Names())
+	}
+	return nil
+}
+
+// updateOperators maps the compound assignment and increment operators to the arithmetic they do
+var updateOperators = map[scanner.TokenType]scanner.TokenType{
+	scanner.PLUS_EQUAL:  scanner.PLUS,
+	scanner.MINUS_EQUAL: scanner.MINUS,
+	scanner.STAR_EQUAL:  scanner.STAR,
+	scanner.SLASH_EQUAL: scanner.SLASH,
+	scanner.PLUS_PLUS:   scanner.PLUS,
+	scanner.MINUS_MINUS: scanner.MINUS,
+}
+
+// UpdateExpr evaluates the target only once, for a property that's the object it's on
+func (i *Interpreter) UpdateExpr(update parser.Update) (interface{}, error) {
+	op := update.Operator
+	op.Type = updateOperators[op.Type]
+
+	var old, res interface{}
+	switch target := update.Target.(type) {
+	case *parser.Variable:
+		var err error
+		if old, err = i.lookUpVariable(target.Name, target); err != nil {
+			return nil, err
+		}
+		value, err := i.Evaluate(update.Value)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = binaryOp(op, old, value); err != nil {
+			return nil, err
+		}
+		if err := i.assignVariable(target.Name, target, res); err != nil {
+			return nil, err
+		}
+	case parser.Get:
+		object, err := i.Evaluate(target.Object)
+		if err != nil {
+			return nil, err
+		}
+		instance, ok := object.(*LoxInstance)
+		if !ok {
+			return nil, RuntimeError{Token: target.Name, Msg: "Only instances have fields"}
+		}
+		if old, err = instance.Get(target.Name); err != nil {
+			return nil, err
+		}
+		value, err := i.Evaluate(update.Value)
+		if err != nil {
+			return nil, err
+		}
+		if res, err = binaryOp(op, old, value); err != nil {
+			return nil, err
+		}
+		instance.Set(target.Name, res)
+	default:
+		return nil, RuntimeError{Token: update.Operator, Msg: "Invalid assignment target"}
+	}
+
+	if update.Postfix {
+		return old, nil
+	}
+	return res, nil
+}
+
+// Resolve is called by the resolver, depth is the number of scopes between
+// the expression and the one its variable is declared in
+func (i *Interpreter) Resolve(expr parser.Expr, depth int) {
+	i.locals[expr] = depth
+}
+
+func (i *Interpreter) lookUpVariable(name scanner.Token, expr parser.Expr) (interface{}, error) {
+	if distance, ok := i.locals[expr]; ok {
+		return i.environment.GetAt(distance, name.Lexeme), nil
+	}
+
+	value, err := i.globals.Get(name)
+	if err != nil {
+		// a typo might be of a local, so suggest from everything in scope, not only globals
+		return nil, undefined("variable", name, i.environment.Names())
+	}
+	return value, nil
+}
+
+func (i *Interpreter) UnaryExpr(u parser.Unary) (interface{}, error) {
+	right, err := i.Evaluate(u.Right)
+	if err != nil {
+		return nil, err
+	}
+	if native, ok := i.prefixNatives[u.Operator.Type]; ok {
+		return i.callOperator(native, u.Operator, right)
+	}
 	switch u.Operator.Type {
 	case scanner.MINUS:
 		err := checkNumberOperand(u.Operator, right)
 		if err != nil {
 			return nil, err
 		}
+		if n, ok := right.(int64); ok {
+			return checkOverflow(u.Operator, -n, n != math.MinInt64)
+		}
 		return -(right.(float64)), nil
 	case scanner.PLUS:
 		err := checkNumberOperand(u.Operator, right)
 		if err != nil {
 			return nil, err
 		}
-		return right.(float64), nil
+		return right, nil
 	case scanner.BANG:
-		return isTruthy(right), nil
+		return !isTruthy(right), nil
 	default:
 		return nil, RuntimeError{
 			Token: u.Operator,
@@ -146,27 +756,62 @@ func UnaryExpr(u parser.Unary) (interface{}, error) {
 }
 
 func checkNumberOperands(operator scanner.Token, op1, op2 interface{}) error {
-	switch op1.(type) {
-	case float64:
-		switch op2.(type) {
-		case float64:
-			return nil
-		}
+	if isNumber(op1) && isNumber(op2) {
+		return nil
 	}
 	return RuntimeError{Token: operator, Msg: fmt.Sprintf("%v or %v is not a number", op1, op2)}
 }
 
 func checkNumberOperand(operator scanner.Token, num interface{}) error {
 	switch num.(type) {
-	case float64:
+	case int64, float64:
 		return nil
 	default:
-		return RuntimeError{Token: operator, Msg: "%v is not a number"}
+		return RuntimeError{Token: operator, Msg: fmt.Sprintf("%v is not a number", num)}
+	}
+}
+
+func isNumber(o interface{}) bool {
+	switch o.(type) {
+	case int64, float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkOverflow is the result of integer arithmetic if it fits, ints don't wrap around silently
+func checkOverflow(operator scanner.Token, res int64, fits bool) (interface{}, error) {
+	if !fits {
+		return nil, RuntimeError{Token: operator, Msg: "integer overflow"}
 	}
+	return res, nil
 }
 
+// integers gives back both operands if they are both int64, mixed arithmetic goes through toFloat
+func integers(left, right interface{}) (int64, int64, bool) {
+	a, ok1 := left.(int64)
+	b, ok2 := right.(int64)
+	return a, b, ok1 && ok2
+}
+
+func toFloat(num interface{}) float64 {
+	if n, ok := num.(int64); ok {
+		return float64(n)
+	}
+	return num.(float64)
+}
+
+// isEqual compares by value, objects like functions and instances are pointers so they compare by identity.
+// numbers compare by value across int64 and float64
 func isEqual(a, b interface{}) bool {
-	return reflect.DeepEqual(a, b)
+	if isNumber(a) && isNumber(b) {
+		if a, b, ok := integers(a, b); ok {
+			return a == b
+		}
+		return toFloat(a) == toFloat(b)
+	}
+	return a == b
 }
 
 func isTruthy(o interface{}) bool {
@@ -180,4 +825,31 @@ func isTruthy(o interface{}) bool {
 	default:
 		return true
 	}
-}
\ No newline at end of file
+}
+
+// formatFloat shows a float is one even when it's whole, 2.0 and not 2 which is an int.
+// Very big and very small ones get an exponent instead of all their digits
+func formatFloat(f float64) string {
+	if abs := math.Abs(f); abs >= 1e21 || (abs != 0 && abs < 1e-6) || math.IsNaN(f) {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	text := strconv.FormatFloat(f, 'f', -1, 64)
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+	return text
+}
+
+// Stringify turns a lox value into the text the user sees
+func Stringify(o interface{}) string {
+	switch v := o.(type) {
+	case nil:
+		return "nil"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return formatFloat(v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -1,8 +1,12 @@
 package interpreter
 
 import (
+    "dexianta/glox/errorhandle"
     "dexianta/glox/parser"
     "dexianta/glox/scanner"
+    "errors"
+    "fmt"
+    "math"
     "github.com/stretchr/testify/assert"
     "testing"
 )
@@ -19,7 +23,545 @@ func TestBinaryExpr(t *testing.T) {
         Right:    parser.Literal{Value: float64(5)},
     }
 
-    res, err := BinaryExpr(expr)
+    res, err := NewInterpreter().BinaryExpr(expr)
     assert.Nil(t, err)
     assert.Equal(t, res, float64(8))
 }
+
+func TestInterpret(t *testing.T) {
+    plus := scanner.Token{Type: scanner.PLUS, Lexeme: "+"}
+    stmts := []parser.Stmt{
+        parser.Expression{Expression: parser.Literal{Value: float64(1)}},
+        parser.Expression{Expression: parser.Binary{
+            Left:     parser.Literal{Value: float64(1)},
+            Operator: plus,
+            Right:    parser.Literal{Value: "a"},
+        }},
+    }
+
+    err := NewInterpreter().Interpret(stmts)
+    assert.Equal(t, RuntimeError{
+        Token: plus,
+        Msg:   "operands must be two numbers or two strings",
+        Stack: []Frame{{Function: "<script>", File: "<script>", Line: 0}},
+    }, err)
+}
+
+func TestEnvironment(t *testing.T) {
+    a := scanner.Token{Type: scanner.IDENTIFIER, Lexeme: "a", Line: 1}
+    b := scanner.Token{Type: scanner.IDENTIFIER, Lexeme: "b", Line: 2}
+    i := NewInterpreter()
+
+    stmts := []parser.Stmt{
+        parser.Var{Name: a, Initializer: parser.Literal{Value: float64(1)}},
+        parser.Block{Statements: []parser.Stmt{
+            parser.Var{Name: a, Initializer: parser.Literal{Value: float64(2)}},
+        }},
+        parser.Expression{Expression: &parser.Assign{Name: a, Value: parser.Literal{Value: "one"}}},
+    }
+    assert.Nil(t, i.Interpret(stmts))
+
+    res, err := i.Evaluate(&parser.Variable{Name: a})
+    assert.Nil(t, err)
+    assert.Equal(t, "one", res)
+
+    _, err = i.Evaluate(&parser.Variable{Name: b})
+    assert.Equal(t, RuntimeError{Token: b, Msg: "Undefined variable 'b'"}, err)
+
+    _, err = i.Evaluate(&parser.Assign{Name: b, Value: parser.Literal{Value: nil}})
+    assert.Equal(t, RuntimeError{Token: b, Msg: "Undefined variable 'b'"}, err)
+}
+
+func TestLogicalExpr(t *testing.T) {
+    or := scanner.Token{Type: scanner.OR, Lexeme: "or"}
+    and := scanner.Token{Type: scanner.AND, Lexeme: "and"}
+    undefined := &parser.Variable{Name: scanner.Token{Type: scanner.IDENTIFIER, Lexeme: "undefined"}}
+    i := NewInterpreter()
+
+    // the right operand would fail, so it must not be evaluated
+    res, err := i.Evaluate(parser.Logical{Left: parser.Literal{Value: "hi"}, Operator: or, Right: undefined})
+    assert.Nil(t, err)
+    assert.Equal(t, "hi", res)
+
+    res, err = i.Evaluate(parser.Logical{Left: parser.Literal{Value: nil}, Operator: and, Right: undefined})
+    assert.Nil(t, err)
+    assert.Equal(t, nil, res)
+
+    res, err = i.Evaluate(parser.Logical{Left: parser.Literal{Value: nil}, Operator: or, Right: parser.Literal{Value: float64(2)}})
+    assert.Nil(t, err)
+    assert.Equal(t, float64(2), res)
+}
+
+func interpret(t *testing.T, source string) (*Interpreter, error) {
+    reporter := errorhandle.NewReporter(source)
+    s := scanner.NewScanner(source, reporter)
+    p := parser.NewParser(s.ScanTokens(), reporter)
+    stmts := p.Parse()
+    assert.NotNil(t, stmts)
+
+    i := NewInterpreter()
+    resolver := NewResolver(i, reporter)
+    if err := resolver.Resolve(stmts); err != nil {
+        return i, err
+    }
+    return i, i.Interpret(stmts)
+}
+
+func global(t *testing.T, i *Interpreter, name string) interface{} {
+    value, err := i.globals.Get(scanner.Token{Type: scanner.IDENTIFIER, Lexeme: name})
+    assert.Nil(t, err)
+    return value
+}
+
+func TestFunction(t *testing.T) {
+    t.Run("closure", func(t *testing.T) {
+        i, err := interpret(t, `
+fun makeCounter() {
+  var count = 0;
+  fun inc() { count = count + 1; return count; }
+  return inc;
+}
+var counter = makeCounter();
+counter();
+var res = counter();`)
+        assert.Nil(t, err)
+        assert.Equal(t, int64(2), global(t, i, "res"))
+    })
+
+    t.Run("return without value", func(t *testing.T) {
+        i, err := interpret(t, "fun f() { return; } var res = f();")
+        assert.Nil(t, err)
+        assert.Equal(t, nil, global(t, i, "res"))
+    })
+
+    t.Run("arity", func(t *testing.T) {
+        _, err := interpret(t, "fun f(a, b) {}\nf(1);")
+        assert.Equal(t, RuntimeError{
+            Token: scanner.Token{Type: scanner.RIGHT_PAREN, Lexeme: ")", Line: 2, Column: 4, Start: 18, End: 19},
+            Msg:   "Expected 2 arguments but got 1",
+            Stack: []Frame{{Function: "<script>", File: "<script>", Line: 2}},
+        }, err)
+    })
+
+    t.Run("not callable", func(t *testing.T) {
+        _, err := interpret(t, "\"str\"();")
+        assert.Equal(t, RuntimeError{
+            Token: scanner.Token{Type: scanner.RIGHT_PAREN, Lexeme: ")", Line: 1, Column: 7, Start: 6, End: 7},
+            Msg:   "Can only call functions and classes",
+            Stack: []Frame{{Function: "<script>", File: "<script>", Line: 1}},
+        }, err)
+    })
+}
+
+func TestResolver(t *testing.T) {
+    t.Run("closure keeps its binding", func(t *testing.T) {
+        i, err := interpret(t, `
+var a = "global";
+var first;
+var second;
+{
+  fun show() { return a; }
+  first = show();
+  var a = "block";
+  second = show();
+}`)
+        assert.Nil(t, err)
+        assert.Equal(t, "global", global(t, i, "first"))
+        assert.Equal(t, "global", global(t, i, "second"))
+    })
+
+    t.Run("static errors", func(t *testing.T) {
+        for _, source := range []string{
+            "return 1;",
+            "{ var a = 1; var a = 2; }",
+            "{ var a = a; }",
+        } {
+            _, err := interpret(t, source)
+            assert.Equal(t, ResolveError, err, source)
+        }
+    })
+}
+
+func TestClass(t *testing.T) {
+    t.Run("fields, methods and init", func(t *testing.T) {
+        i, err := interpret(t, `
+class Counter {
+  init(start) { this.count = start; }
+  inc() { this.count = this.count + 1; return this; }
+}
+var c = Counter(1);
+var inc = c.inc;
+inc();
+var res = c.inc().count;
+var again = c.init(5) == c;`)
+        assert.Nil(t, err)
+        assert.Equal(t, int64(3), global(t, i, "res"))
+        assert.Equal(t, true, global(t, i, "again"))
+    })
+
+    t.Run("undefined property", func(t *testing.T) {
+        _, err := interpret(t, "class A {}\nA().b;")
+        assert.Equal(t, RuntimeError{
+            Token: scanner.Token{Type: scanner.IDENTIFIER, Lexeme: "b", Line: 2, Column: 5, Start: 15, End: 16},
+            Msg:   "Undefined property 'b'",
+            Stack: []Frame{{Function: "<script>", File: "<script>", Line: 2}},
+        }, err)
+    })
+
+    t.Run("static errors", func(t *testing.T) {
+        for _, source := range []string{
+            "print this;",
+            "class A { init() { return 1; } }",
+        } {
+            _, err := interpret(t, source)
+            assert.Equal(t, ResolveError, err, source)
+        }
+    })
+}
+
+func TestInheritance(t *testing.T) {
+    t.Run("super", func(t *testing.T) {
+        i, err := interpret(t, `
+class A {
+  name() { return "A"; }
+  describe() { return "I am " + this.name(); }
+}
+class B < A {
+  name() { return "B"; }
+  parent() { return super.name(); }
+}
+class C < B {}
+var describe = C().describe();
+var parent = C().parent();`)
+        assert.Nil(t, err)
+        assert.Equal(t, "I am B", global(t, i, "describe"))
+        assert.Equal(t, "A", global(t, i, "parent"))
+    })
+
+    t.Run("superclass must be a class", func(t *testing.T) {
+        _, err := interpret(t, "var A = 1;\nclass B < A {}")
+        assert.Equal(t, RuntimeError{
+            Token: scanner.Token{Type: scanner.IDENTIFIER, Lexeme: "A", Line: 2, Column: 11, Start: 21, End: 22},
+            Msg:   "Superclass must be a class",
+            Stack: []Frame{{Function: "<script>", File: "<script>", Line: 2}},
+        }, err)
+    })
+
+    t.Run("static errors", func(t *testing.T) {
+        for _, source := range []string{
+            "class A < A {}",
+            "super.a();",
+            "class A { f() { super.f(); } }",
+        } {
+            _, err := interpret(t, source)
+            assert.Equal(t, ResolveError, err, source)
+        }
+    })
+}
+
+func TestRegisterNative(t *testing.T) {
+    source := "var sum = add(1, 2);\nvar now = clock();\nfail();"
+    reporter := errorhandle.NewReporter(source)
+    s := scanner.NewScanner(source, reporter)
+    p := parser.NewParser(s.ScanTokens(), reporter)
+    stmts := p.Parse()
+
+    i := NewInterpreter()
+    i.RegisterNative("add", 2, func(args []Value) (Value, error) {
+        return args[0].(int64) + args[1].(int64), nil
+    })
+    i.RegisterNative("fail", 0, func(args []Value) (Value, error) {
+        return nil, errors.New("host failure")
+    })
+
+    err := i.Interpret(stmts)
+    assert.Equal(t, RuntimeError{
+        Token: scanner.Token{Type: scanner.RIGHT_PAREN, Lexeme: ")", Line: 3, Column: 6, Start: 45, End: 46},
+        Msg:   "host failure",
+        Stack: []Frame{{Function: "<script>", File: "<script>", Line: 3}, {Function: "fail", File: "<script>", Line: 3}},
+    }, err)
+    assert.Equal(t, int64(3), global(t, i, "sum"))
+    assert.IsType(t, float64(0), global(t, i, "now"))
+    assert.Equal(t, "<native fn clock>", fmt.Sprint(global(t, i, "clock")))
+
+    // go values are turned into lox ones, or rejected at the call
+    source = "var count = count();\nvar half = half();\nlist() == list();"
+    reporter = errorhandle.NewReporter(source)
+    s = scanner.NewScanner(source, reporter)
+    p = parser.NewParser(s.ScanTokens(), reporter)
+    stmts = p.Parse()
+
+    i = NewInterpreter()
+    i.RegisterNative("count", 0, func(args []Value) (Value, error) { return 3, nil })
+    i.RegisterNative("half", 0, func(args []Value) (Value, error) { return float32(0.5), nil })
+    i.RegisterNative("list", 0, func(args []Value) (Value, error) { return []Value{1, 2}, nil })
+
+    err = i.Interpret(stmts)
+    assert.Equal(t, int64(3), global(t, i, "count"))
+    assert.Equal(t, 0.5, global(t, i, "half"))
+    if assert.IsType(t, RuntimeError{}, err) {
+        assert.Equal(t, "<native fn list> returned a []interface {}, which isn't a lox value", err.(RuntimeError).Msg)
+    }
+}
+
+func TestStackTrace(t *testing.T) {
+    t.Run("frames", func(t *testing.T) {
+        _, err := interpret(t, `
+class Box {
+  init(value) { this.value = check(value); }
+}
+fun check(value) {
+  return -value;
+}
+Box("oops");`)
+        runtimeErr := err.(RuntimeError)
+        assert.Equal(t, "oops is not a number", runtimeErr.Msg)
+        assert.Equal(t, []Frame{
+            {Function: "<script>", File: "<script>", Line: 8},
+            {Function: "Box.init", File: "<script>", Line: 3},
+            {Function: "check", File: "<script>", Line: 6},
+        }, runtimeErr.Stack)
+    })
+
+    t.Run("deep recursion is capped", func(t *testing.T) {
+        _, err := interpret(t, "fun f() { f(); }\nf();")
+        runtimeErr := err.(RuntimeError)
+        assert.Equal(t, "Stack overflow", runtimeErr.Msg)
+        assert.Equal(t, maxCallDepth+1, len(runtimeErr.Stack))
+
+        assert.Equal(t, `Traceback (most recent call last):
+  <script>:2 in <script>
+  <script>:1 in f
+  ... 9997 frames omitted
+  <script>:1 in f
+  <script>:1 in f
+`, runtimeErr.Traceback(4))
+    })
+}
+
+func TestSuggestion(t *testing.T) {
+    for source, suggestion := range map[string]string{
+        "var count = 1;\nprint cuont;":                          "count",
+        "fun f() { var total = 1; totl = 2; }\nf();":             "total",
+        "class A { method() {} }\nA().methd();":                 "method",
+        "class A { init() { this.value = 1; } }\nA().valeu;":     "value",
+        "class A { method() {} }\nclass B < A { f() { super.mehtod(); } }\nB().f();": "method",
+    } {
+        _, err := interpret(t, source)
+        assert.Equal(t, suggestion, err.(RuntimeError).Suggestion, source)
+    }
+
+    _, err := interpret(t, "var count = 1;\nprint xyz;")
+    assert.Equal(t, "", err.(RuntimeError).Suggestion)
+}
+
+func TestTryCatch(t *testing.T) {
+    t.Run("thrown value", func(t *testing.T) {
+        i, err := interpret(t, `
+var log = "";
+fun check(x) {
+  if (x > 2) throw "too big";
+  return x;
+}
+try {
+  log = log + "try ";
+  check(5);
+  log = log + "unreachable ";
+} catch (e) {
+  log = log + e + " ";
+} finally {
+  log = log + "finally";
+}`)
+        assert.Nil(t, err)
+        assert.Equal(t, "try too big finally", global(t, i, "log"))
+    })
+
+    t.Run("interpreter errors are error objects", func(t *testing.T) {
+        i, err := interpret(t, `
+var message;
+var line;
+try {
+  1 + nil;
+} catch (e) {
+  message = e.message;
+  line = e.line;
+}`)
+        assert.Nil(t, err)
+        assert.Equal(t, "operands must be two numbers or two strings", global(t, i, "message"))
+        assert.Equal(t, int64(5), global(t, i, "line"))
+    })
+
+    t.Run("finally runs on return", func(t *testing.T) {
+        i, err := interpret(t, `
+var cleaned = false;
+fun f() {
+  try { return "try"; } finally { cleaned = true; }
+}
+var res = f();`)
+        assert.Nil(t, err)
+        assert.Equal(t, "try", global(t, i, "res"))
+        assert.Equal(t, true, global(t, i, "cleaned"))
+    })
+
+    t.Run("uncaught", func(t *testing.T) {
+        _, err := interpret(t, "try { throw 1; } finally {}")
+        runtimeErr := err.(RuntimeError)
+        assert.Equal(t, "Uncaught exception: 1", runtimeErr.Msg)
+        assert.Equal(t, int64(1), runtimeErr.Value)
+    })
+}
+
+func TestInterpolation(t *testing.T) {
+    i, err := interpret(t, `
+var a = 1;
+var b = 2.5;
+var s = "total: ${a + b}, nested ${"${a}"}, nil ${nil}\t\u{41}";`)
+    assert.Nil(t, err)
+    assert.Equal(t, "total: 3.5, nested 1, nil nil\tA", global(t, i, "s"))
+}
+
+func TestIntegers(t *testing.T) {
+    for source, expected := range map[string]interface{}{
+        "9007199254740993 + 2": int64(9007199254740995),
+        "0xFF - 0b1":           int64(254),
+        "7 * 6":                int64(42),
+        "7 ~/ 2":               int64(3),
+        "-7 % 3":               int64(-1),
+        "7 / 2":                3.5,
+        "1 + 0.5":              1.5,
+        "7.5 ~/ 2":             float64(3),
+        "7.5 % 2":              1.5,
+        "1 == 1.0":             true,
+        "2 > 1.5":              true,
+        "-(3)":                 int64(-3),
+    } {
+        i, err := interpret(t, "var res = "+source+";")
+        assert.Nil(t, err, source)
+        assert.Equal(t, expected, global(t, i, "res"), source)
+    }
+
+    _, err := interpret(t, "1 % 0;")
+    assert.Equal(t, "integer division by zero", err.(RuntimeError).Msg)
+
+    for source, expected := range map[string]interface{}{
+        "9223372036854775806 + 1":         int64(math.MaxInt64),
+        "-9223372036854775807 - 1":        int64(math.MinInt64),
+        "-1 * 9223372036854775807":        int64(-math.MaxInt64),
+        "(-9223372036854775807 - 1) % -1": int64(0),
+    } {
+        i, err := interpret(t, "var res = "+source+";")
+        assert.Nil(t, err, source)
+        assert.Equal(t, expected, global(t, i, "res"), source)
+    }
+
+    for _, source := range []string{
+        "9223372036854775807 + 1",
+        "-9223372036854775807 - 2",
+        "9223372036854775807 - -1",
+        "4611686018427387904 * 2",
+        "-1 * (-9223372036854775807 - 1)",
+        "(-9223372036854775807 - 1) * -1",
+        "(-9223372036854775807 - 1) ~/ -1",
+        "-(-9223372036854775807 - 1)",
+        "var a = 9223372036854775807; a++",
+    } {
+        _, err := interpret(t, source+";")
+        if assert.IsType(t, RuntimeError{}, err, source) {
+            assert.Equal(t, "integer overflow", err.(RuntimeError).Msg, source)
+        }
+    }
+
+    // a whole float still prints as a float
+    for value, expected := range map[interface{}]string{
+        int64(2):     "2",
+        2.0:          "2.0",
+        -0.5:         "-0.5",
+        1.5e300:      "1.5e+300",
+        1e-7:         "1e-07",
+        123456789.0:  "123456789.0",
+        math.Inf(-1): "-Inf",
+    } {
+        assert.Equal(t, expected, Stringify(value))
+    }
+}
+
+func TestConditional(t *testing.T) {
+    i, err := interpret(t, `
+var calls = "";
+fun f(name) { calls = calls + name; return name; }
+var picked = true ? f("then") : f("else");
+var nested = false ? 1 : nil ? 2 : 3;
+var last = (f("a"), f("b"));`)
+    assert.Nil(t, err)
+    assert.Equal(t, "then", global(t, i, "picked"))
+    assert.Equal(t, int64(3), global(t, i, "nested"))
+    assert.Equal(t, "b", global(t, i, "last"))
+    assert.Equal(t, "thenab", global(t, i, "calls"))
+}
+
+func TestUpdate(t *testing.T) {
+    i, err := interpret(t, `
+var a = 1;
+a += 2;
+a *= 4;
+a -= 2;
+var b = a++;
+var c = ++a;
+var d = a--;
+var s = "x";
+s += "y";
+var q = 7;
+q /= 2;
+
+class Counter {}
+var counter = Counter();
+counter.n = 0;
+var objects = 0;
+fun get() { objects += 1; return counter; }
+get().n += 5;
+get().n++;
+var e = --get().n;
+
+fun local() {
+  var x = 10;
+  x -= 1;
+  return x--;
+}
+var f = local();`)
+    assert.Nil(t, err)
+    assert.Equal(t, int64(11), global(t, i, "a"))
+    assert.Equal(t, int64(10), global(t, i, "b"))
+    assert.Equal(t, int64(12), global(t, i, "c"))
+    assert.Equal(t, int64(12), global(t, i, "d"))
+    assert.Equal(t, "xy", global(t, i, "s"))
+    assert.Equal(t, 3.5, global(t, i, "q"))
+    assert.Equal(t, int64(5), global(t, i, "e"))
+    assert.Equal(t, int64(3), global(t, i, "objects"))
+    assert.Equal(t, int64(9), global(t, i, "f"))
+}
+
+func TestLambda(t *testing.T) {
+    i, err := interpret(t, `
+fun apply(f, a, b) { return f(a, b); }
+var sum = apply(fun (a, b) { return a + b; }, 1, 2);
+var product = apply((a, b) => a * b, 3, 4);
+var constant = (() => "c")();
+var grouped = (1 + 2);
+
+fun counter() {
+  var n = 0;
+  return () => { n += 1; return n; };
+}
+var next = counter();
+next();
+var count = next();
+fun (x) { print x; };
+var name = "${apply((a, b) => a, fun () {}, nil)}";`)
+    assert.Nil(t, err)
+    assert.Equal(t, int64(3), global(t, i, "sum"))
+    assert.Equal(t, int64(12), global(t, i, "product"))
+    assert.Equal(t, "c", global(t, i, "constant"))
+    assert.Equal(t, int64(3), global(t, i, "grouped"))
+    assert.Equal(t, int64(2), global(t, i, "count"))
+    assert.Equal(t, "<fn <lambda>>", global(t, i, "name"))
+}
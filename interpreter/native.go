@@ -0,0 +1,112 @@
+package interpreter
+
+import (
+	"dexianta/glox/parser"
+	"dexianta/glox/scanner"
+	"fmt"
+	"math"
+	"reflect"
+	"time"
+)
+
+// Value is any lox value: nil, bool, int64, float64, string, or one of the callables and instances
+type Value = interface{}
+
+// NativeFunction is a callable implemented in go
+type NativeFunction struct {
+	name  string
+	arity int
+	fn    func(args []Value) (Value, error)
+}
+
+func (n *NativeFunction) Arity() int {
+	return n.arity
+}
+
+func (n *NativeFunction) Call(_ *Interpreter, args []Value) (Value, error) {
+	res, err := n.fn(args)
+	if err != nil {
+		return nil, err
+	}
+	return n.loxValue(res)
+}
+
+// loxValue checks what the go function returned is a lox value, go ints and floats of any
+// size become int64 and float64. Anything else, like a slice, can't be used from lox
+func (n *NativeFunction) loxValue(v Value) (Value, error) {
+	switch v.(type) {
+	case nil, bool, int64, float64, string, LoxCallable, *LoxInstance:
+		return v, nil
+	}
+
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if value.Uint() <= math.MaxInt64 {
+			return int64(value.Uint()), nil
+		}
+		return nil, fmt.Errorf("%s returned %d, it's out of range for an integer", n, value.Uint())
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	default:
+		return nil, fmt.Errorf("%s returned a %T, which isn't a lox value", n, v)
+	}
+}
+
+func (n *NativeFunction) String() string {
+	return "<native fn " + n.name + ">"
+}
+
+// RegisterNative binds a go function to a global name, the arity is checked before fn is called.
+// An error returned by fn becomes a RuntimeError at the call site.
+func (i *Interpreter) RegisterNative(name string, arity int, fn func(args []Value) (Value, error)) {
+	i.globals.Define(name, &NativeFunction{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	})
+}
+
+// RegisterBinary adds a binary operator to the language, fn is called with both operands.
+// The scanner and the parser need Operators to know about it. The error is for a precedence
+// that isn't above parser.PREC_NONE, or a symbol like "or" or "=" that can't be an operator
+func (i *Interpreter) RegisterBinary(symbol string, precedence int, associativity parser.Associativity, fn func(args []Value) (Value, error)) error {
+	if err := i.operators.AddBinary(symbol, precedence, associativity); err != nil {
+		return err
+	}
+	i.binaryNatives[scanner.TokenType(symbol)] = &NativeFunction{name: symbol, arity: 2, fn: fn}
+	return nil
+}
+
+// RegisterPrefix adds a prefix operator, fn is called with the operand. The precedence
+// is like the one of parser.Operators.AddPrefix
+func (i *Interpreter) RegisterPrefix(symbol string, precedence int, fn func(args []Value) (Value, error)) error {
+	if err := i.operators.AddPrefix(symbol, precedence); err != nil {
+		return err
+	}
+	i.prefixNatives[scanner.TokenType(symbol)] = &NativeFunction{name: symbol, arity: 1, fn: fn}
+	return nil
+}
+
+// Operators is the operator table with the registered operators in it, for the parser.
+// Its Symbols are for the scanner
+func (i *Interpreter) Operators() *parser.Operators {
+	return i.operators
+}
+
+// callOperator is like calling a native, an error from it is reported at the operator
+func (i *Interpreter) callOperator(native *NativeFunction, operator scanner.Token, args ...Value) (Value, error) {
+	res, err := native.Call(i, args)
+	if _, ok := err.(RuntimeError); err != nil && !ok {
+		err = RuntimeError{Token: operator, Msg: err.Error()}
+	}
+	return res, err
+}
+
+func (i *Interpreter) registerBuiltins() {
+	i.RegisterNative("clock", 0, func(args []Value) (Value, error) {
+		return float64(time.Now().UnixNano()) / float64(time.Second), nil
+	})
+}
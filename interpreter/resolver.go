@@ -0,0 +1,288 @@
+package interpreter
+
+import (
+	"dexianta/glox/errorhandle"
+	"dexianta/glox/parser"
+	"dexianta/glox/scanner"
+	"errors"
+)
+
+// Resolver walks the syntax tree once before it's run, and tells the interpreter
+// how many scopes away each local variable is declared
+
+type FunctionType int
+
+const (
+	NONE FunctionType = iota
+	FUNCTION
+	INITIALIZER
+	METHOD
+)
+
+type ClassType int
+
+const (
+	NO_CLASS ClassType = iota
+	IN_CLASS
+	IN_SUBCLASS
+)
+
+var ResolveError = errors.New("resolve error")
+
+type Resolver struct {
+	interpreter     *Interpreter
+	scopes          []map[string]bool // false means declared but not yet defined
+	currentFunction FunctionType
+	currentClass    ClassType
+	hadError        bool
+	reporter        *errorhandle.Reporter
+}
+
+func NewResolver(interpreter *Interpreter, reporter *errorhandle.Reporter) Resolver {
+	return Resolver{
+		interpreter:     interpreter,
+		reporter:        reporter,
+		currentFunction: NONE,
+		currentClass:    NO_CLASS,
+	}
+}
+
+// Resolve reports every static error it finds, and returns ResolveError if there's any
+func (r *Resolver) Resolve(stmts []parser.Stmt) error {
+	r.resolveStmts(stmts)
+	if r.hadError {
+		return ResolveError
+	}
+	return nil
+}
+
+func (r *Resolver) resolveStmts(stmts []parser.Stmt) {
+	for _, stmt := range stmts {
+		r.resolveStmt(stmt)
+	}
+}
+
+func (r *Resolver) resolveStmt(stmt parser.Stmt) {
+	switch stmt := stmt.(type) {
+	case parser.Block:
+		r.beginScope()
+		r.resolveStmts(stmt.Statements)
+		r.endScope()
+	case parser.Var:
+		r.declare(stmt.Name)
+		if stmt.Initializer != nil {
+			r.resolveExpr(stmt.Initializer)
+		}
+		r.define(stmt.Name)
+	case parser.Function:
+		// define eagerly so the function can refer to itself
+		r.declare(stmt.Name)
+		r.define(stmt.Name)
+		r.resolveFunction(stmt, FUNCTION)
+	case parser.Class:
+		enclosingClass := r.currentClass
+		r.currentClass = IN_CLASS
+
+		r.declare(stmt.Name)
+		r.define(stmt.Name)
+
+		if stmt.Superclass != nil {
+			if stmt.Superclass.Name.Lexeme == stmt.Name.Lexeme {
+				r.error(stmt.Superclass.Name, "A class can't inherit from itself")
+			}
+			r.currentClass = IN_SUBCLASS
+			r.resolveExpr(stmt.Superclass)
+
+			r.beginScope()
+			r.scopes[len(r.scopes)-1]["super"] = true
+		}
+
+		r.beginScope()
+		r.scopes[len(r.scopes)-1]["this"] = true
+		for _, method := range stmt.Methods {
+			functionType := METHOD
+			if method.Name.Lexeme == "init" {
+				functionType = INITIALIZER
+			}
+			r.resolveFunction(method, functionType)
+		}
+		r.endScope()
+
+		if stmt.Superclass != nil {
+			r.endScope()
+		}
+
+		r.currentClass = enclosingClass
+	case parser.Expression:
+		r.resolveExpr(stmt.Expression)
+	case parser.If:
+		r.resolveExpr(stmt.Condition)
+		r.resolveStmt(stmt.ThenBranch)
+		if stmt.ElseBranch != nil {
+			r.resolveStmt(stmt.ElseBranch)
+		}
+	case parser.Print:
+		r.resolveExpr(stmt.Expression)
+	case parser.Return:
+		if r.currentFunction == NONE {
+			r.error(stmt.Keyword, "Can't return from top-level code")
+		}
+		if stmt.Value != nil {
+			if r.currentFunction == INITIALIZER {
+				r.error(stmt.Keyword, "Can't return a value from an initializer")
+			}
+			r.resolveExpr(stmt.Value)
+		}
+	case parser.While:
+		r.resolveExpr(stmt.Condition)
+		r.resolveStmt(stmt.Body)
+	case parser.Throw:
+		r.resolveExpr(stmt.Value)
+	case parser.Try:
+		r.beginScope()
+		r.resolveStmts(stmt.Body)
+		r.endScope()
+
+		// the error variable shares its scope with the catch body
+		if stmt.CatchName != nil {
+			r.beginScope()
+			r.declare(*stmt.CatchName)
+			r.define(*stmt.CatchName)
+			r.resolveStmts(stmt.Catch)
+			r.endScope()
+		}
+
+		r.beginScope()
+		r.resolveStmts(stmt.Finally)
+		r.endScope()
+	}
+}
+
+func (r *Resolver) resolveExpr(expr parser.Expr) {
+	switch expr := expr.(type) {
+	case *parser.Variable:
+		if len(r.scopes) != 0 {
+			if defined, ok := r.scopes[len(r.scopes)-1][expr.Name.Lexeme]; ok && !defined {
+				r.error(expr.Name, "Can't read local variable in its own initializer")
+			}
+		}
+		r.resolveLocal(expr, expr.Name)
+	case *parser.Assign:
+		r.resolveExpr(expr.Value)
+		r.resolveLocal(expr, expr.Name)
+	case parser.Binary:
+		r.resolveExpr(expr.Left)
+		r.resolveExpr(expr.Right)
+	case parser.Call:
+		r.resolveExpr(expr.Callee)
+		for _, arg := range expr.Arguments {
+			r.resolveExpr(arg)
+		}
+	case parser.Get:
+		r.resolveExpr(expr.Object)
+	case parser.Set:
+		r.resolveExpr(expr.Value)
+		r.resolveExpr(expr.Object)
+	case *parser.This:
+		if r.currentClass == NO_CLASS {
+			r.error(expr.Keyword, "Can't use 'this' outside of a class")
+			return
+		}
+		r.resolveLocal(expr, expr.Keyword)
+	case *parser.Super:
+		if r.currentClass == NO_CLASS {
+			r.error(expr.Keyword, "Can't use 'super' outside of a class")
+			return
+		} else if r.currentClass != IN_SUBCLASS {
+			r.error(expr.Keyword, "Can't use 'super' in a class with no superclass")
+			return
+		}
+		r.resolveLocal(expr, expr.Keyword)
+	case parser.Lambda:
+		r.resolveFunction(expr.Function, FUNCTION)
+	case parser.Update:
+		r.resolveExpr(expr.Target)
+		r.resolveExpr(expr.Value)
+	case parser.Conditional:
+		r.resolveExpr(expr.Condition)
+		r.resolveExpr(expr.ThenBranch)
+		r.resolveExpr(expr.ElseBranch)
+	case parser.Interpolation:
+		for _, part := range expr.Parts {
+			r.resolveExpr(part)
+		}
+	case parser.Grouping:
+		r.resolveExpr(expr.Expression)
+	case parser.Logical:
+		r.resolveExpr(expr.Left)
+		r.resolveExpr(expr.Right)
+	case parser.Unary:
+		r.resolveExpr(expr.Right)
+	case parser.Literal:
+	}
+}
+
+func (r *Resolver) resolveFunction(function parser.Function, functionType FunctionType) {
+	enclosingFunction := r.currentFunction
+	r.currentFunction = functionType
+	defer func() { r.currentFunction = enclosingFunction }()
+
+	r.beginScope()
+	for _, param := range function.Params {
+		r.declare(param)
+		r.define(param)
+	}
+	r.resolveStmts(function.Body)
+	r.endScope()
+}
+
+// resolveLocal leaves globals unresolved, the interpreter looks them up dynamically
+func (r *Resolver) resolveLocal(expr parser.Expr, name scanner.Token) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if _, ok := r.scopes[i][name.Lexeme]; ok {
+			r.interpreter.Resolve(expr, len(r.scopes)-1-i)
+			return
+		}
+	}
+}
+
+func (r *Resolver) beginScope() {
+	r.scopes = append(r.scopes, map[string]bool{})
+}
+
+func (r *Resolver) endScope() {
+	r.scopes = r.scopes[:len(r.scopes)-1]
+}
+
+func (r *Resolver) declare(name scanner.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope[name.Lexeme]; ok {
+		r.error(name, "Already a variable with this name in this scope")
+	}
+	scope[name.Lexeme] = false
+}
+
+func (r *Resolver) define(name scanner.Token) {
+	if len(r.scopes) == 0 {
+		return
+	}
+	r.scopes[len(r.scopes)-1][name.Lexeme] = true
+}
+
+func (r *Resolver) error(token scanner.Token, msg string) {
+	r.reporter.Report(errorhandle.Diagnostic{
+		Severity: errorhandle.ERROR,
+		Stage:    errorhandle.RESOLVE,
+		Line:     token.Line,
+		Column:   token.Column,
+		Start:    token.Start,
+		End:      token.End,
+		Message:  msg,
+		Token:    token.Lexeme,
+	})
+	r.hadError = true
+}
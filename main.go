@@ -3,64 +3,166 @@ package main
 import (
 	"bufio"
 	"dexianta/glox/errorhandle"
+	"dexianta/glox/interpreter"
 	"dexianta/glox/parser"
 	"dexianta/glox/scanner"
-	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 )
 
-// TODO: different error at different stages
-var hasScanError bool
-var hasParsingError bool
-var hasRuntimeError bool
-
 func main() {
 	if len(os.Args) > 2 {
-		panic("Usage: glox [script]")
-		os.Exit(64)
+		fmt.Fprintln(os.Stderr, "Usage: glox [script | -]")
+		os.Exit(exitUsage)
+	}
+
+	var err error
+	if len(os.Args) == 2 && os.Args[1] == "-" {
+		lox := interpreter.NewInterpreter()
+		lox.SetFile("<stdin>")
+		err = runStream(lox, os.Stdin)
 	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
+		err = runFile(os.Args[1])
 	} else {
-		runPrompt()
+		err = runPrompt()
 	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	os.Exit(exitCode(err))
 }
 
 func runFile(path string) error {
 	contentBytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		return err
+		return IOError{err}
 	}
 
-	return run(string(contentBytes))
+	lox := interpreter.NewInterpreter()
+	lox.SetFile(path)
+	return run(lox, string(contentBytes))
 }
 
+// runPrompt only fails if stdin can't be read, errors in a line are printed and the prompt goes on
 func runPrompt() error {
+	reader := bufio.NewReader(os.Stdin)
+	// the interpreter lives across lines so variables are kept
+	lox := interpreter.NewInterpreter()
+	lox.SetFile("<stdin>")
 	for {
 		fmt.Printf("> ")
-		reader := bufio.NewReader(os.Stdin)
 		//TODO: multi-line input
 		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			fmt.Println()
+			return nil
+		}
 		if err != nil {
-			fmt.Println("errorhandle reading line: ", err.Error())
+			return IOError{err}
 		}
 
-		if err := run(line); err != nil {
-			fmt.Println("errorhandle running line: ", err.Error())
+		if err := run(lox, line); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 		}
 	}
 }
 
-func run(code string) error {
-	s := scanner.NewScanner(code)
+// run returns the diagnostics of the first stage that failed, wrapped in that stage's error type
+func run(lox *interpreter.Interpreter, code string) error {
+	reporter := errorhandle.NewReporter(code)
+
+	s := scanner.NewScanner(code, reporter)
+	s.AddOperators(lox.Operators().Symbols()...)
 	tokens := s.ScanTokens()
-	parser := parser.NewParser(tokens)
-	_ = parser.Parse()
+	if reporter.HadError() {
+		return ScanError{reporter.Diagnostics()}
+	}
+
+	parser := parser.NewParser(tokens, reporter)
+	parser.SetOperators(lox.Operators())
+	stmts := parser.Parse()
+	if reporter.HadError() {
+		return ParseError{reporter.Diagnostics()}
+	}
+
+	return execute(lox, reporter, stmts)
+}
+
+// runStream runs the script as it's read, a declaration at a time, so only the one being
+// parsed is in memory. Declarations before a syntax error have already run when it's found.
+// Without the source at hand the diagnostics don't show the line they're on
+func runStream(lox *interpreter.Interpreter, reader io.Reader) error {
+	reporter := errorhandle.NewReporter("")
+
+	s := scanner.NewReaderScanner(reader, reporter)
+	s.AddOperators(lox.Operators().Symbols()...)
+	p := parser.NewStreamParser(&s, reporter)
+	p.SetOperators(lox.Operators())
+	// like the prompt, every declaration is resolved with what the earlier ones declared
+	resolver := interpreter.NewResolver(lox, reporter)
+	for {
+		stmt, ok := p.Next()
+		if err := p.Err(); err != nil {
+			return IOError{err}
+		}
+		if reporter.HadError() {
+			// nothing runs after a syntax error, the rest is only parsed for its errors
+			for ok {
+				_, ok = p.Next()
+			}
+			return syntaxError(reporter)
+		}
+		if !ok {
+			return nil
+		}
 
-	if errorhandle.HadError {
-		return errors.New("something is wrong")
+		if err := resolver.Resolve([]parser.Stmt{stmt}); err != nil {
+			return ResolveError{reporter.Diagnostics()}
+		}
+		if err := lox.Interpret([]parser.Stmt{stmt}); err != nil {
+			return runtimeError(reporter, err)
+		}
+	}
+}
+
+// syntaxError is the error of a stream that didn't parse, scanning and parsing are
+// interleaved so any scan error makes it a ScanError
+func syntaxError(reporter *errorhandle.Reporter) error {
+	for _, d := range reporter.Diagnostics() {
+		if d.Stage == errorhandle.SCAN {
+			return ScanError{reporter.Diagnostics()}
+		}
+	}
+	return ParseError{reporter.Diagnostics()}
+}
+
+// execute resolves and interprets statements that parsed cleanly
+func execute(lox *interpreter.Interpreter, reporter *errorhandle.Reporter, stmts []parser.Stmt) error {
+	resolver := interpreter.NewResolver(lox, reporter)
+	if err := resolver.Resolve(stmts); err != nil {
+		return ResolveError{reporter.Diagnostics()}
+	}
+
+	if err := lox.Interpret(stmts); err != nil {
+		return runtimeError(reporter, err)
 	}
 
 	return nil
 }
+
+// runtimeError reports an error from the interpreter along with the diagnostics before it
+func runtimeError(reporter *errorhandle.Reporter, err error) error {
+	if runtimeErr, ok := err.(interpreter.RuntimeError); ok {
+		reporter.Report(runtimeErr.Diagnostic())
+	} else {
+		reporter.Report(errorhandle.Diagnostic{
+			Severity: errorhandle.ERROR,
+			Stage:    errorhandle.RUNTIME,
+			Message:  err.Error(),
+		})
+	}
+	return RuntimeError{Diagnostics: reporter.Diagnostics(), Cause: err}
+}
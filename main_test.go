@@ -1,11 +1,171 @@
 package main
 
 import (
+	"dexianta/glox/errorhandle"
+	"dexianta/glox/interpreter"
+	"dexianta/glox/parser"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestRun(t *testing.T) {
-	err := run("1 = 1")
+	err := run(interpreter.NewInterpreter(), "print 1 == 1;\n1 + 2;")
 	assert.Nil(t, err)
-}
\ No newline at end of file
+}
+
+func TestRunRuntimeError(t *testing.T) {
+	err := run(interpreter.NewInterpreter(), "print 1;\n1 + \"a\";")
+	var runtimeErr interpreter.RuntimeError
+	assert.True(t, errors.As(err, &runtimeErr))
+	assert.Equal(t, "operands must be two numbers or two strings", runtimeErr.Msg)
+	assert.Equal(t, exitSoftware, exitCode(err))
+}
+
+func TestRunVariables(t *testing.T) {
+	err := run(interpreter.NewInterpreter(), "var a = 1;\n{ var a = 2; a = a + 1; }\nprint a;")
+	assert.Nil(t, err)
+
+	err = run(interpreter.NewInterpreter(), "b = 1;")
+	assert.NotNil(t, err)
+}
+
+func TestRunDiagnostics(t *testing.T) {
+	lox := interpreter.NewInterpreter()
+
+	err := run(lox, "print 1 +;")
+	assert.Equal(t, ParseError{errorhandle.Diagnostics{{
+		Severity:   errorhandle.ERROR,
+		Stage:      errorhandle.PARSE,
+		Line:       1,
+		Column:     10,
+		Start:      9,
+		End:        10,
+		Message:    "expect expression",
+		Token:      ";",
+		SourceLine: "print 1 +;",
+	}}}, err)
+	assert.Equal(t, "[line 1:10] Error at ';' (parse): expect expression\nprint 1 +;\n         ^", err.Error())
+
+	// a previous mistake doesn't leak into the next run
+	err = run(lox, "print 1;")
+	assert.Nil(t, err)
+}
+
+func TestExitCode(t *testing.T) {
+	lox := interpreter.NewInterpreter()
+
+	assert.Equal(t, 0, exitCode(run(lox, "print 1;")))
+	assert.Equal(t, exitDataErr, exitCode(run(lox, "print @;")))
+	assert.Equal(t, exitDataErr, exitCode(run(lox, "print ;")))
+	assert.Equal(t, exitDataErr, exitCode(run(lox, "return 1;")))
+	assert.Equal(t, exitSoftware, exitCode(run(lox, "print -nil;")))
+	assert.Equal(t, exitIOErr, exitCode(runFile("does/not/exist.lox")))
+
+	var scanErr ScanError
+	assert.True(t, errors.As(run(lox, "print @;"), &scanErr))
+	var parseErr ParseError
+	assert.False(t, errors.As(run(lox, "print @;"), &parseErr))
+}
+
+func TestRunTraceback(t *testing.T) {
+	lox := interpreter.NewInterpreter()
+	lox.SetFile("test.lox")
+
+	err := run(lox, "fun f() {\n  return -nil;\n}\nf();")
+	assert.Equal(t, `Traceback (most recent call last):
+  test.lox:4 in <script>
+  test.lox:2 in f
+[line 2:10] Error at '-' (runtime): <nil> is not a number
+  return -nil;
+         ^`, err.Error())
+}
+
+func TestRunStream(t *testing.T) {
+	lox := interpreter.NewInterpreter()
+	assert.Nil(t, runStream(lox, strings.NewReader("var a = 1;\nprint a + 1;")))
+
+	var scanErr ScanError
+	assert.True(t, errors.As(runStream(lox, strings.NewReader("print @;\nprint ;")), &scanErr))
+	var parseErr ParseError
+	assert.True(t, errors.As(runStream(lox, strings.NewReader("print ;")), &parseErr))
+	var ioErr IOError
+	assert.True(t, errors.As(runStream(lox, iotest.ErrReader(errors.New("broken pipe"))), &ioErr))
+	var runtimeErr interpreter.RuntimeError
+	assert.True(t, errors.As(runStream(lox, strings.NewReader("-nil;")), &runtimeErr))
+
+	// each declaration runs once it's parsed, before the rest is read
+	reader := io.MultiReader(strings.NewReader("var ran = true;\nfun f() { return ran; }\n"), iotest.ErrReader(errors.New("broken pipe")))
+	assert.True(t, errors.As(runStream(lox, reader), &ioErr))
+	assert.Nil(t, run(lox, `if (!f()) throw "not run";`))
+
+	// but nothing after a syntax error
+	assert.True(t, errors.As(runStream(lox, strings.NewReader("var b = 1;\nprint ;\nb = 2;")), &parseErr))
+	assert.Nil(t, run(lox, `if (b != 1) throw "ran past the error";`))
+}
+
+func TestRunOperators(t *testing.T) {
+	lox := interpreter.NewInterpreter()
+	assert.Nil(t, lox.RegisterBinary("**", parser.PREC_UNARY+5, parser.RIGHT, func(args []interpreter.Value) (interpreter.Value, error) {
+		base, ok1 := args[0].(int64)
+		exponent, ok2 := args[1].(int64)
+		if !ok1 || !ok2 {
+			return nil, errors.New("'**' takes two integers")
+		}
+		res := int64(1)
+		for ; exponent > 0; exponent-- {
+			res *= base
+		}
+		return res, nil
+	}))
+	assert.Nil(t, lox.RegisterBinary("in", parser.PREC_COMPARISON, parser.LEFT, func(args []interpreter.Value) (interpreter.Value, error) {
+		return strings.Contains(args[1].(string), args[0].(string)), nil
+	}))
+	assert.Nil(t, lox.RegisterPrefix("#", parser.PREC_UNARY, func(args []interpreter.Value) (interpreter.Value, error) {
+		return int64(len(args[0].(string))), nil
+	}))
+
+	assert.Nil(t, run(lox, `
+var a = -2 ** 2;
+var b = 2 ** 3 ** 2;
+var c = 1 + 2 ** 2 * 3;
+var d = "at" in "cat" and !("dog" in "cat");
+var e = (#"four") ** 2;`))
+	for _, check := range []string{"a == -4", "b == 512", "c == 13", "d", "e == 16"} {
+		assert.Nil(t, run(lox, "if (!("+check+")) throw \""+check+"\";"), check)
+	}
+
+	var runtimeErr interpreter.RuntimeError
+	assert.True(t, errors.As(run(lox, `1.5 ** 2;`), &runtimeErr))
+	assert.Equal(t, "'**' takes two integers", runtimeErr.Msg)
+	assert.Equal(t, "**", runtimeErr.Token.Lexeme)
+}
+
+func TestRunOperatorsBinaryAndPrefix(t *testing.T) {
+	lox := interpreter.NewInterpreter()
+	// a binary "-" and a prefix "*" leave the other use of the symbol alone
+	assert.Nil(t, lox.RegisterBinary("-", parser.PREC_TERM, parser.LEFT, func(args []interpreter.Value) (interpreter.Value, error) {
+		return "minus", nil
+	}))
+	assert.Nil(t, lox.RegisterPrefix("*", parser.PREC_UNARY, func(args []interpreter.Value) (interpreter.Value, error) {
+		return "deref", nil
+	}))
+	assert.Nil(t, run(lox, `var minus = "minus"; var deref = "deref";`))
+	for _, check := range []string{"-3 < 0", "1 - 2 == minus", "2 * 3 == 6", "*2 == deref"} {
+		assert.Nil(t, run(lox, "if (!("+check+")) throw \""+check+"\";"), check)
+	}
+
+	for _, symbol := range []string{"or", "and", ",", "=", "?"} {
+		assert.NotNil(t, lox.RegisterBinary(symbol, parser.PREC_TERM, parser.LEFT, nil), symbol)
+	}
+	assert.NotNil(t, lox.RegisterPrefix("++", parser.PREC_UNARY, nil))
+
+	// a prefix "~" doesn't take the start of "~/"
+	assert.Nil(t, lox.RegisterPrefix("~", parser.PREC_UNARY, func(args []interpreter.Value) (interpreter.Value, error) {
+		return ^args[0].(int64), nil
+	}))
+	assert.Nil(t, run(lox, `if (7 ~/ 2 != 3 or ~1 != -2) throw "~";`))
+}
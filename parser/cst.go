@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"dexianta/glox/scanner"
+	"strings"
+)
+
+// Node is a node of the concrete syntax tree. Unlike the ast it keeps every token,
+// so with tokens scanned in trivia mode it prints back to the exact source
+type Node struct {
+	Kind     string        // what it parsed to, like "Binary" or "Var", and "Error" for what didn't parse
+	Children []interface{} // *Node and scanner.Token, in source order
+}
+
+// String is the source text of the node, with the trivia of its tokens
+func (n *Node) String() string {
+	var b strings.Builder
+	n.write(&b)
+	return b.String()
+}
+
+func (n *Node) write(b *strings.Builder) {
+	for _, child := range n.Children {
+		switch child := child.(type) {
+		case *Node:
+			child.write(b)
+		case scanner.Token:
+			b.WriteString(child.FullText())
+		}
+	}
+}
+
+// Tokens lists the tokens under the node in source order
+func (n *Node) Tokens() []scanner.Token {
+	var tokens []scanner.Token
+	for _, child := range n.Children {
+		switch child := child.(type) {
+		case *Node:
+			tokens = append(tokens, child.Tokens()...)
+		case scanner.Token:
+			tokens = append(tokens, child)
+		}
+	}
+	return tokens
+}
+
+// ParseTree parses like Parse, and also builds the concrete syntax tree of the whole source,
+// its root is a "Program" ending with the EOF token
+func (p *Parser) ParseTree() ([]Stmt, *Node) {
+	p.tree = &Node{Kind: "Program"}
+	stmts := p.Parse()
+	p.tree.Children = append(p.tree.Children, p.peek())
+
+	tree := p.tree
+	p.tree = nil
+	return stmts, tree
+}
+
+// mark is where a node of the tree starts, the tokens consumed from there on go in it
+func (p *Parser) mark() int {
+	if p.tree == nil {
+		return 0
+	}
+	return len(p.tree.Children)
+}
+
+// markPrevious is a mark that takes the token just consumed too,
+// a statement is only known once its keyword is matched
+func (p *Parser) markPrevious() int {
+	return p.mark() - 1
+}
+
+// wrap groups everything since mark into a node, nodes that are finished before
+// their parent is are the ones that end up nested in it
+func (p *Parser) wrap(kind string, mark int) {
+	if p.tree == nil {
+		return
+	}
+	node := &Node{Kind: kind, Children: append([]interface{}{}, p.tree.Children[mark:]...)}
+	p.tree.Children = append(p.tree.Children[:mark], node)
+}
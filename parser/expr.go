@@ -42,4 +42,124 @@ type Unary struct {
 	Right    Expr
 }
 
-func (u Unary) isExpr() {}
\ No newline at end of file
+func (u Unary) isExpr() {}
+
+// ========================= //
+
+// Variable and Assign are always used as pointers, so the resolver can tell
+// two references to the same name apart
+
+type Variable struct {
+	Name scanner.Token
+}
+
+func (v *Variable) isExpr() {}
+
+// ========================= //
+
+type Assign struct {
+	Name  scanner.Token
+	Value Expr
+}
+
+func (a *Assign) isExpr() {}
+
+// ========================= //
+
+type Logical struct {
+	Left     Expr
+	Operator scanner.Token
+	Right    Expr
+}
+
+func (l Logical) isExpr() {}
+
+// ========================= //
+
+type Call struct {
+	Callee    Expr
+	Paren     scanner.Token // the closing paren, used to report errors
+	Arguments []Expr
+}
+
+func (c Call) isExpr() {}
+
+// ========================= //
+
+type Get struct {
+	Object Expr
+	Name   scanner.Token
+}
+
+func (g Get) isExpr() {}
+
+// ========================= //
+
+type Set struct {
+	Object Expr
+	Name   scanner.Token
+	Value  Expr
+}
+
+func (s Set) isExpr() {}
+
+// ========================= //
+
+// This and Super are resolved like variables, so they are pointers as well
+type This struct {
+	Keyword scanner.Token
+}
+
+func (t *This) isExpr() {}
+
+// ========================= //
+
+type Super struct {
+	Keyword scanner.Token
+	Method  scanner.Token
+}
+
+func (s *Super) isExpr() {}
+
+// ========================= //
+
+// Interpolation is a string with "${}" in it, the parts are stringified and concatenated
+type Interpolation struct {
+	Parts []Expr
+}
+
+func (i Interpolation) isExpr() {}
+
+// ========================= //
+
+// Conditional only evaluates the branch it picks
+type Conditional struct {
+	Condition  Expr
+	ThenBranch Expr
+	ElseBranch Expr
+}
+
+func (c Conditional) isExpr() {}
+
+// ========================= //
+
+// Update is a compound assignment like "+=", or a "++" or "--" that adds or subtracts a Value of 1.
+// Target is a *Variable or a Get, and it's evaluated only once
+type Update struct {
+	Target   Expr
+	Operator scanner.Token
+	Value    Expr
+	Postfix  bool // a postfix "++" or "--" gives the value from before the update
+}
+
+func (u Update) isExpr() {}
+
+// ========================= //
+
+// Lambda is a function expression, "fun (a) { ... }" or "(a) => a + 1". The arrow form's
+// expression body is a single return statement, and the function is named "<lambda>"
+type Lambda struct {
+	Function Function
+}
+
+func (l Lambda) isExpr() {}
@@ -0,0 +1,146 @@
+package parser
+
+import (
+	"dexianta/glox/scanner"
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Associativity is how a chain of operators of the same precedence groups
+type Associativity int
+
+const (
+	LEFT  Associativity = iota // a - b - c is (a - b) - c
+	RIGHT                      // a ** b ** c is a ** (b ** c)
+)
+
+// precedence of the built-in operators, a higher one binds tighter. They're spaced out
+// so registered operators can go in between, anything registered has to be above PREC_NONE
+const (
+	PREC_NONE       = 0
+	PREC_OR         = 10
+	PREC_AND        = 20
+	PREC_EQUALITY   = 30
+	PREC_COMPARISON = 40
+	PREC_TERM       = 50
+	PREC_FACTOR     = 60
+	PREC_UNARY      = 70 // the operand of a prefix operator only takes binary operators above this
+)
+
+// Operator is a row of the binary operator table
+type Operator struct {
+	Precedence    int
+	Associativity Associativity
+}
+
+// Operators is the table the parser climbs for binary and prefix operators. Every token type
+// is its lexeme, so a symbol like "**" is the token type the scanner gives it
+type Operators struct {
+	binary map[scanner.TokenType]Operator
+	prefix map[scanner.TokenType]int // the precedence the operand is parsed at
+	added  []string                  // symbols that aren't built-in tokens, for the scanner
+}
+
+func NewOperators() *Operators {
+	o := &Operators{
+		binary: map[scanner.TokenType]Operator{},
+		prefix: map[scanner.TokenType]int{},
+	}
+	for precedence, types := range map[int][]scanner.TokenType{
+		PREC_OR:         {scanner.OR},
+		PREC_AND:        {scanner.AND},
+		PREC_EQUALITY:   {scanner.BANG_EQUAL, scanner.EQUAL_EQUAL},
+		PREC_COMPARISON: {scanner.GREATER, scanner.GREATER_EQUAL, scanner.LESS, scanner.LESS_EQUAL},
+		PREC_TERM:       {scanner.MINUS, scanner.PLUS},
+		PREC_FACTOR:     {scanner.SLASH, scanner.STAR, scanner.PERCENT, scanner.TILDE_SLASH},
+	} {
+		for _, t := range types {
+			o.binary[t] = Operator{Precedence: precedence, Associativity: LEFT}
+		}
+	}
+	o.prefix[scanner.BANG] = PREC_UNARY
+	o.prefix[scanner.MINUS] = PREC_UNARY
+	return o
+}
+
+// defaultOperators is the table of a parser that isn't given one, it's never changed
+var defaultOperators = NewOperators()
+
+// reserved are the tokens the grammar itself gives a meaning, like "=" or "?". The keywords are
+// too, "and" and "or" short-circuit so they can't be a call to a function
+var reserved = map[scanner.TokenType]bool{
+	scanner.LEFT_PAREN: true, scanner.RIGHT_PAREN: true, scanner.LEFT_BRACE: true, scanner.RIGHT_BRACE: true,
+	scanner.COMMA: true, scanner.DOT: true, scanner.SEMICOLON: true, scanner.QUESTION: true, scanner.COLON: true,
+	scanner.EQUAL: true, scanner.PLUS_EQUAL: true, scanner.MINUS_EQUAL: true, scanner.STAR_EQUAL: true,
+	scanner.SLASH_EQUAL: true, scanner.PLUS_PLUS: true, scanner.MINUS_MINUS: true, scanner.ARROW: true,
+}
+
+// AddBinary adds a binary operator, for one that's already there it changes how it binds.
+// The precedence has to be above PREC_NONE, the parser would never get to the operator
+func (o *Operators) AddBinary(symbol string, precedence int, associativity Associativity) error {
+	if err := check(symbol, precedence); err != nil {
+		return err
+	}
+	o.add(symbol)
+	o.binary[scanner.TokenType(symbol)] = Operator{Precedence: precedence, Associativity: associativity}
+	return nil
+}
+
+// AddPrefix adds a prefix operator, its operand only takes binary operators of the precedence
+// or above. "!" and "-" are at PREC_UNARY, so "-a * b" is "(-a) * b"
+func (o *Operators) AddPrefix(symbol string, precedence int) error {
+	if err := check(symbol, precedence); err != nil {
+		return err
+	}
+	o.add(symbol)
+	o.prefix[scanner.TokenType(symbol)] = precedence
+	return nil
+}
+
+func check(symbol string, precedence int) error {
+	if reserved[scanner.TokenType(symbol)] {
+		return fmt.Errorf("'%s' is part of the grammar, it can't be an operator", symbol)
+	}
+	for _, keyword := range scanner.Keywords() {
+		if symbol == keyword {
+			return fmt.Errorf("'%s' is a keyword, it can't be an operator", symbol)
+		}
+	}
+	if precedence <= PREC_NONE {
+		return fmt.Errorf("operator '%s' has precedence %d, it has to be above PREC_NONE", symbol, precedence)
+	}
+	return nil
+}
+
+func (o *Operators) add(symbol string) {
+	t := scanner.TokenType(symbol)
+	_, isBinary := o.binary[t]
+	_, isPrefix := o.prefix[t]
+	if isBinary || isPrefix || scanner.IsToken(symbol) {
+		return
+	}
+	o.added = append(o.added, symbol)
+}
+
+// word tells if the token is of an operator added as a word like "in", the scanner makes
+// those keywords. They can still be property names
+func (o *Operators) word(t scanner.TokenType) bool {
+	for _, symbol := range o.added {
+		if symbol == string(t) {
+			first, _ := utf8.DecodeRuneInString(symbol)
+			return unicode.IsLetter(first) || first == '_'
+		}
+	}
+	return false
+}
+
+// Symbols lists the operators the scanner has to be told about with AddOperators
+func (o *Operators) Symbols() []string {
+	return o.added
+}
+
+// SetOperators makes the parser use a table with operators added to it
+func (p *Parser) SetOperators(operators *Operators) {
+	p.operators = operators
+}
@@ -3,53 +3,542 @@ package parser
 import (
 	"dexianta/glox/errorhandle"
 	"dexianta/glox/scanner"
+	"dexianta/glox/utils"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 // syntax tree
 // ===========================================================
-// expression     → equality ;
-// equality       → comparison ( ( "!=" | "==" ) comparison )* ;
-// comparison     → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
-// term           → factor ( ( "-" | "+" ) factor )* ;
-// factor         → unary ( ( "/" | "*" ) unary )* ;
-// unary          → ( "!" | "-" ) unary | primary ;
-// primary        → NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" ;
+// program        → declaration* EOF ;
+// declaration    → classDecl | funDecl | varDecl | statement ;
+// classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
+// funDecl        → "fun" function ;
+// function       → IDENTIFIER "(" parameters? ")" block ;
+// parameters     → IDENTIFIER ( "," IDENTIFIER )* ;
+// varDecl        → "var" IDENTIFIER ( "=" expression )? ";" ;
+// statement      → exprStmt | forStmt | ifStmt | printStmt | returnStmt | throwStmt | tryStmt
+//                | whileStmt | block ;
+// exprStmt       → expression ";" ;
+// forStmt        → "for" "(" ( varDecl | exprStmt | ";" ) expression? ";" expression? ")" statement ;
+// ifStmt         → "if" "(" expression ")" statement ( "else" statement )? ;
+// printStmt      → "print" expression ";" ;
+// returnStmt     → "return" expression? ";" ;
+// throwStmt      → "throw" expression ";" ;
+// tryStmt        → "try" block ( "catch" "(" IDENTIFIER ")" block )? ( "finally" block )? ;
+// whileStmt      → "while" "(" expression ")" statement ;
+// block          → "{" declaration* "}" ;
+// expression     → comma ;
+// comma          → assignment ( "," assignment )* ;
+// assignment     → ( call "." )? IDENTIFIER ( "=" | "+=" | "-=" | "*=" | "/=" ) assignment | conditional ;
+// conditional    → binary ( "?" expression ":" conditional )? ;
+// binary         → prefix ( BINARY_OP prefix )* ;
+// prefix         → PREFIX_OP prefix | ( "++" | "--" ) prefix | postfix ;
+// postfix        → call ( "++" | "--" )? ;
+// call           → primary ( "(" arguments? ")" | "." IDENTIFIER )* ;
+// arguments      → assignment ( "," assignment )* ;
+// primary        → NUMBER | STRING | "true" | "false" | "nil" | "this" | "(" expression ")" | IDENTIFIER
+//                | "super" "." IDENTIFIER | interpolation | lambda ;
+// lambda         → "fun" "(" parameters? ")" block | "(" parameters? ")" "=>" ( assignment | block ) ;
+// interpolation  → ( INTERPOLATION expression )+ STRING ;
+//
+// binary is parsed by precedence climbing over an Operators table, the built-in
+// BINARY_OP from loosest to tightest, all left associative, are:
+//   "or" ; "and" ; "!=" "==" ; ">" ">=" "<" "<=" ; "-" "+" ; "/" "*" "%" "~/"
+// PREFIX_OP is "!" or "-", the operand of one only takes binary operators tighter than it
+
+const maxArgs = 255
 
 type Parser struct {
-	current int
-	tokens  []scanner.Token
+	current   int
+	stmtStart int // index of the first token of the statement being parsed
+	tokens    []scanner.Token
+	reporter  *errorhandle.Reporter
+
+	// a streaming parser pulls tokens from source when it needs them,
+	// err is the first error the source returned
+	source TokenSource
+	err    error
+
+	// the concrete syntax tree being built by ParseTree, nil otherwise
+	tree *Node
+
+	operators *Operators
+}
+
+// TokenSource hands out tokens one at a time ending with EOF, a *scanner.Scanner is one
+type TokenSource interface {
+	Next() (scanner.Token, error)
 }
 
-func NewParser(tokens []scanner.Token) Parser {
+func NewParser(tokens []scanner.Token, reporter *errorhandle.Reporter) Parser {
 	return Parser{
-		tokens: tokens,
+		tokens:    tokens,
+		reporter:  reporter,
+		operators: defaultOperators,
 	}
 }
 
-func (p *Parser) Parse() Expr {
-	expr, err := p.expr()
-	switch err {
-	case ParseError:
+// NewStreamParser reads tokens from source as it parses, and forgets them once
+// their statement is done
+func NewStreamParser(source TokenSource, reporter *errorhandle.Reporter) Parser {
+	return Parser{
+		source:    source,
+		reporter:  reporter,
+		operators: defaultOperators,
+	}
+}
+
+// Parse keeps going after a syntax error, every error goes to the reporter,
+// and the statements that did parse are returned
+func (p *Parser) Parse() []Stmt {
+	var stmts []Stmt
+	for {
+		stmt, ok := p.Next()
+		if !ok {
+			return stmts
+		}
+		if stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+}
+
+// Next parses one top-level declaration, so a stream can be run as it's parsed.
+// The statement is nil if it didn't parse, ok is false once there's nothing left
+func (p *Parser) Next() (stmt Stmt, ok bool) {
+	if p.isAtEnd() {
+		return nil, false
+	}
+	p.discard()
+	return p.declaration(), true
+}
+
+// declaration is where the parser recovers, a broken declaration is dropped
+// and parsing picks up again at the next statement
+func (p *Parser) declaration() Stmt {
+	mark := p.mark()
+	stmt, err := p.declare()
+	if err == ParseError {
+		p.sync()
+		p.wrap("Error", mark)
 		return nil
-	default:
-		return expr
 	}
+	return stmt
+}
+
+func (p *Parser) declare() (Stmt, error) {
+	p.stmtStart = p.current
+	if p.match(scanner.CLASS) {
+		return p.classDeclaration()
+	}
+	// "fun (" starts a lambda, that's an expression statement
+	if p.check(scanner.FUN) && p.peekAt(1).Type != scanner.LEFT_PAREN {
+		p.advance()
+		return p.function("function")
+	}
+	if p.match(scanner.VAR) {
+		return p.varDeclaration()
+	}
+	return p.statement()
+}
+
+func (p *Parser) classDeclaration() (Stmt, error) {
+	mark := p.markPrevious()
+	name, err := p.consume(scanner.IDENTIFIER, "Expect class name")
+	if err != nil {
+		return nil, err
+	}
+
+	var superclass *Variable
+	if p.match(scanner.LESS) {
+		superName, err := p.consume(scanner.IDENTIFIER, "Expect superclass name")
+		if err != nil {
+			return nil, err
+		}
+		superclass = &Variable{superName}
+	}
+
+	if _, err := p.consume(scanner.LEFT_BRACE, "Expect '{' before class body"); err != nil {
+		return nil, err
+	}
+
+	var methods []Function
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		method, err := p.function("method")
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method.(Function))
+	}
+
+	if _, err := p.consume(scanner.RIGHT_BRACE, "Expect '}' after class body"); err != nil {
+		return nil, err
+	}
+	p.wrap("Class", mark)
+	return Class{Name: name, Superclass: superclass, Methods: methods}, nil
+}
+
+// function parses the name, parameters and body, kind is only used for error messages
+func (p *Parser) function(kind string) (Stmt, error) {
+	mark := p.mark()
+	if p.current > 0 && p.previous().Type == scanner.FUN {
+		mark = p.markPrevious()
+	}
+	name, err := p.consume(scanner.IDENTIFIER, "Expect "+kind+" name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after "+kind+" name"); err != nil {
+		return nil, err
+	}
+	params, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consume(scanner.LEFT_BRACE, "Expect '{' before "+kind+" body"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	p.wrap("Function", mark)
+	return Function{Name: name, Params: params, Body: body}, nil
+}
+
+// parameters parses the parameter list up to the ")", the "(" is already consumed
+func (p *Parser) parameters() ([]scanner.Token, error) {
+	var params []scanner.Token
+	if !p.check(scanner.RIGHT_PAREN) {
+		for {
+			if len(params) >= maxArgs {
+				p.error(p.peek(), fmt.Sprintf("Can't have more than %d parameters", maxArgs))
+			}
+			param, err := p.consume(scanner.IDENTIFIER, "Expect parameter name")
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, param)
+			if !p.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+	if _, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after parameters"); err != nil {
+		return nil, err
+	}
+	return params, nil
+}
+
+func (p *Parser) varDeclaration() (Stmt, error) {
+	mark := p.markPrevious()
+	name, err := p.consume(scanner.IDENTIFIER, "Expect variable name")
+	if err != nil {
+		return nil, err
+	}
+
+	var initializer Expr
+	if p.match(scanner.EQUAL) {
+		initializer, err = p.expr()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(scanner.SEMICOLON, "Expect ';' after variable declaration"); err != nil {
+		return nil, err
+	}
+	p.wrap("Var", mark)
+	return Var{Name: name, Initializer: initializer}, nil
+}
+
+func (p *Parser) statement() (Stmt, error) {
+	if p.match(scanner.FOR) {
+		return p.forStatement()
+	}
+	if p.match(scanner.IF) {
+		return p.ifStatement()
+	}
+	if p.match(scanner.PRINT) {
+		return p.printStatement()
+	}
+	if p.match(scanner.RETURN) {
+		return p.returnStatement()
+	}
+	if p.match(scanner.THROW) {
+		return p.throwStatement()
+	}
+	if p.match(scanner.TRY) {
+		return p.tryStatement()
+	}
+	if p.match(scanner.WHILE) {
+		return p.whileStatement()
+	}
+	if p.match(scanner.LEFT_BRACE) {
+		stmts, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return Block{Statements: stmts}, nil
+	}
+	return p.expressionStatement()
+}
+
+// for loop is only syntactic sugar, it's lowered to a while loop in a block
+func (p *Parser) forStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	if _, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after 'for'"); err != nil {
+		return nil, err
+	}
+
+	var initializer Stmt
+	var err error
+	if p.match(scanner.SEMICOLON) {
+		initializer = nil
+	} else if p.match(scanner.VAR) {
+		initializer, err = p.varDeclaration()
+	} else {
+		initializer, err = p.expressionStatement()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var condition Expr
+	if !p.check(scanner.SEMICOLON) {
+		if condition, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(scanner.SEMICOLON, "Expect ';' after loop condition"); err != nil {
+		return nil, err
+	}
+
+	var increment Expr
+	if !p.check(scanner.RIGHT_PAREN) {
+		if increment, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after for clauses"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	if increment != nil {
+		body = Block{Statements: []Stmt{body, Expression{increment}}}
+	}
+	if condition == nil {
+		condition = Literal{true}
+	}
+	body = While{Condition: condition, Body: body}
+	if initializer != nil {
+		body = Block{Statements: []Stmt{initializer, body}}
+	}
+
+	p.wrap("For", mark)
+	return body, nil
+}
+
+func (p *Parser) ifStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	if _, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after 'if'"); err != nil {
+		return nil, err
+	}
+	condition, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after if condition"); err != nil {
+		return nil, err
+	}
+
+	thenBranch, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	// the else binds to the nearest if
+	var elseBranch Stmt
+	if p.match(scanner.ELSE) {
+		if elseBranch, err = p.statement(); err != nil {
+			return nil, err
+		}
+	}
+
+	p.wrap("If", mark)
+	return If{Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}, nil
+}
+
+func (p *Parser) whileStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	if _, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after 'while'"); err != nil {
+		return nil, err
+	}
+	condition, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after condition"); err != nil {
+		return nil, err
+	}
+
+	body, err := p.statement()
+	if err != nil {
+		return nil, err
+	}
+
+	p.wrap("While", mark)
+	return While{Condition: condition, Body: body}, nil
+}
+
+func (p *Parser) block() ([]Stmt, error) {
+	mark := p.markPrevious() // the "{" is consumed by the caller
+	var stmts []Stmt
+	for !p.check(scanner.RIGHT_BRACE) && !p.isAtEnd() {
+		if stmt := p.declaration(); stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	if _, err := p.consume(scanner.RIGHT_BRACE, "Expect '}' after block"); err != nil {
+		return nil, err
+	}
+	p.wrap("Block", mark)
+	return stmts, nil
+}
+
+func (p *Parser) printStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	value, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(scanner.SEMICOLON, "Expect ';' after value"); err != nil {
+		return nil, err
+	}
+	p.wrap("Print", mark)
+	return Print{Expression: value}, nil
+}
+
+func (p *Parser) returnStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	keyword := p.previous()
+
+	var value Expr
+	var err error
+	if !p.check(scanner.SEMICOLON) {
+		if value, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(scanner.SEMICOLON, "Expect ';' after return value"); err != nil {
+		return nil, err
+	}
+	p.wrap("Return", mark)
+	return Return{Keyword: keyword, Value: value}, nil
+}
+
+func (p *Parser) throwStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	keyword := p.previous()
+	value, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.consume(scanner.SEMICOLON, "Expect ';' after thrown value"); err != nil {
+		return nil, err
+	}
+	p.wrap("Throw", mark)
+	return Throw{Keyword: keyword, Value: value}, nil
+}
+
+func (p *Parser) tryStatement() (Stmt, error) {
+	mark := p.markPrevious()
+	if _, err := p.consume(scanner.LEFT_BRACE, "Expect '{' after 'try'"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	stmt := Try{Body: body}
+
+	if p.match(scanner.CATCH) {
+		if _, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after 'catch'"); err != nil {
+			return nil, err
+		}
+		name, err := p.consume(scanner.IDENTIFIER, "Expect error variable name")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after error variable"); err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(scanner.LEFT_BRACE, "Expect '{' before catch body"); err != nil {
+			return nil, err
+		}
+		if stmt.Catch, err = p.block(); err != nil {
+			return nil, err
+		}
+		stmt.CatchName = &name
+	}
+
+	hasFinally := p.match(scanner.FINALLY)
+	if hasFinally {
+		if _, err := p.consume(scanner.LEFT_BRACE, "Expect '{' after 'finally'"); err != nil {
+			return nil, err
+		}
+		if stmt.Finally, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.CatchName == nil && !hasFinally {
+		return nil, p.error(p.peek(), "Expect 'catch' or 'finally' after try block")
+	}
+	p.wrap("Try", mark)
+	return stmt, nil
+}
+
+func (p *Parser) expressionStatement() (Stmt, error) {
+	mark := p.mark()
+	expr, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(scanner.SEMICOLON, "Expect ';' after expression"); err != nil {
+		return nil, err
+	}
+	p.wrap("Expression", mark)
+	return Expression{Expression: expr}, nil
 }
 
 func (p *Parser) expr() (Expr, error) {
-	return p.equality()
+	return p.comma()
 }
 
-func (p *Parser) equality() (Expr, error) {
-	expr, err := p.comparison()
+// comma evaluates both sides and gives the right one, it's a Binary like any other operator
+func (p *Parser) comma() (Expr, error) {
+	mark := p.mark()
+	expr, err := p.assignment()
 	if err != nil {
 		return expr, err
 	}
 
-	for p.match(scanner.BANG_EQUAL, scanner.EQUAL_EQUAL) {
+	for p.match(scanner.COMMA) {
 		operator := p.previous()
-		right, err := p.comparison()
+		right, err := p.assignment()
 		if err != nil {
 			return right, err
 		}
@@ -58,117 +547,436 @@ func (p *Parser) equality() (Expr, error) {
 			Operator: operator,
 			Right:    right,
 		}
+		p.wrap("Binary", mark)
 	}
 
 	return expr, nil
 }
 
-func (p *Parser) comparison() (Expr, error) {
-	expr, err := p.term()
+func (p *Parser) assignment() (Expr, error) {
+	mark := p.mark()
+	expr, err := p.conditional()
 	if err != nil {
 		return expr, err
 	}
 
-	for p.match(scanner.GREATER, scanner.GREATER_EQUAL, scanner.LESS, scanner.LESS_EQUAL) {
-		operator := p.previous()
-		right, err := p.term()
+	if p.match(scanner.EQUAL) {
+		equals := p.previous()
+		value, err := p.assignment()
 		if err != nil {
-			return expr, err
+			return value, err
 		}
-		expr = Binary{
-			Left:     expr,
-			Operator: operator,
-			Right:    right,
+
+		switch target := expr.(type) {
+		case *Variable:
+			p.wrap("Assign", mark)
+			return &Assign{Name: target.Name, Value: value}, nil
+		case Get:
+			p.wrap("Set", mark)
+			return Set{Object: target.Object, Name: target.Name, Value: value}, nil
+		}
+
+		// report but don't bail out, the parser isn't in a confused state
+		p.error(equals, "Invalid assignment target")
+		p.wrap("Error", mark)
+	} else if p.match(scanner.PLUS_EQUAL, scanner.MINUS_EQUAL, scanner.STAR_EQUAL, scanner.SLASH_EQUAL) {
+		operator := p.previous()
+		value, err := p.assignment()
+		if err != nil {
+			return value, err
 		}
+		return p.update(mark, expr, operator, value, false), nil
 	}
 
 	return expr, nil
 }
 
-func (p *Parser) term() (Expr, error) {
-	expr, err := p.factor()
+// conditional is right associative, "a ? b : c ? d : e" is "a ? b : (c ? d : e)"
+func (p *Parser) conditional() (Expr, error) {
+	mark := p.mark()
+	expr, err := p.binary(PREC_NONE + 1)
 	if err != nil {
 		return expr, err
 	}
 
-	for p.match(scanner.MINUS, scanner.PLUS) {
-		operator := p.previous()
-		right, err := p.factor()
+	if p.match(scanner.QUESTION) {
+		thenBranch, err := p.expr()
 		if err != nil {
-			return right, err
+			return nil, err
 		}
-		expr = Binary{
-			Left:     expr,
-			Operator: operator,
-			Right:    right,
+		if _, err := p.consume(scanner.COLON, "Expect ':' after then branch of conditional expression"); err != nil {
+			return nil, err
 		}
+		elseBranch, err := p.conditional()
+		if err != nil {
+			return nil, err
+		}
+		expr = Conditional{Condition: expr, ThenBranch: thenBranch, ElseBranch: elseBranch}
+		p.wrap("Conditional", mark)
 	}
 
 	return expr, nil
 }
 
-func (p *Parser) factor() (Expr, error) {
-	expr, err := p.unary()
+// binary climbs the operator table, it parses the operators with at least minPrecedence.
+// "or" and "and" short-circuit so they're Logical, every other operator is a Binary
+func (p *Parser) binary(minPrecedence int) (Expr, error) {
+	mark := p.mark()
+	expr, err := p.prefix()
 	if err != nil {
 		return expr, err
 	}
 
-	for p.match(scanner.SLASH, scanner.STAR) {
-		operator := p.previous()
-		right, err := p.unary()
+	for {
+		op, ok := p.operators.binary[p.peek().Type]
+		if !ok || op.Precedence < minPrecedence {
+			break
+		}
+		operator := p.advance()
+
+		// the right operand takes the same operator again only if it's right associative
+		next := op.Precedence + 1
+		if op.Associativity == RIGHT {
+			next = op.Precedence
+		}
+		right, err := p.binary(next)
 		if err != nil {
-			return expr, err
+			return right, err
+		}
+
+		if operator.Type == scanner.OR || operator.Type == scanner.AND {
+			expr = Logical{
+				Left:     expr,
+				Operator: operator,
+				Right:    right,
+			}
+			p.wrap("Logical", mark)
+			continue
 		}
 		expr = Binary{
 			Left:     expr,
 			Operator: operator,
 			Right:    right,
 		}
+		p.wrap("Binary", mark)
 	}
 
 	return expr, nil
 }
 
-func (p *Parser) unary() (Expr, error) {
-	if p.match(scanner.BANG, scanner.MINUS) {
-		operator := p.previous()
-		right, err := p.unary()
+func (p *Parser) prefix() (Expr, error) {
+	mark := p.mark()
+	if precedence, ok := p.operators.prefix[p.peek().Type]; ok {
+		operator := p.advance()
+		right, err := p.binary(precedence)
+		if err == nil {
+			p.wrap("Unary", mark)
+		}
 		return Unary{
 			Operator: operator,
 			Right:    right,
 		}, err
 	}
 
-	return p.primary()
+	if p.match(scanner.PLUS_PLUS, scanner.MINUS_MINUS) {
+		operator := p.previous()
+		target, err := p.prefix()
+		if err != nil {
+			return target, err
+		}
+		return p.update(mark, target, operator, Literal{int64(1)}, false), nil
+	}
+
+	return p.postfix()
+}
+
+func (p *Parser) postfix() (Expr, error) {
+	mark := p.mark()
+	expr, err := p.call()
+	if err != nil {
+		return expr, err
+	}
+
+	if p.match(scanner.PLUS_PLUS, scanner.MINUS_MINUS) {
+		return p.update(mark, expr, p.previous(), Literal{int64(1)}, true), nil
+	}
+	return expr, nil
+}
+
+// update checks the target can be assigned to, like assignment it only reports a bad one
+func (p *Parser) update(mark int, target Expr, operator scanner.Token, value Expr, postfix bool) Expr {
+	switch target.(type) {
+	case *Variable, Get:
+		p.wrap("Update", mark)
+	default:
+		p.error(operator, "Invalid assignment target")
+		p.wrap("Error", mark)
+	}
+	return Update{Target: target, Operator: operator, Value: value, Postfix: postfix}
+}
+
+func (p *Parser) call() (Expr, error) {
+	mark := p.mark()
+	expr, err := p.primary()
+	if err != nil {
+		return expr, err
+	}
+
+	for {
+		if p.match(scanner.LEFT_PAREN) {
+			if expr, err = p.finishCall(expr); err != nil {
+				return expr, err
+			}
+			p.wrap("Call", mark)
+		} else if p.match(scanner.DOT) {
+			name, err := p.propertyName()
+			if err != nil {
+				return nil, err
+			}
+			expr = Get{Object: expr, Name: name}
+			p.wrap("Get", mark)
+		} else {
+			break
+		}
+	}
+
+	return expr, nil
+}
+
+// propertyName is the name after a ".", a word operator like "in" is still a name there.
+// Anywhere else a registered word is taken by the operator, like the built-in keywords are
+func (p *Parser) propertyName() (scanner.Token, error) {
+	if p.operators.word(p.peek().Type) {
+		name := p.advance()
+		name.Type = scanner.IDENTIFIER
+		return name, nil
+	}
+	return p.consume(scanner.IDENTIFIER, "Expect property name after '.'")
+}
+
+func (p *Parser) finishCall(callee Expr) (Expr, error) {
+	var args []Expr
+	if !p.check(scanner.RIGHT_PAREN) {
+		for {
+			if len(args) >= maxArgs {
+				p.error(p.peek(), fmt.Sprintf("Can't have more than %d arguments", maxArgs))
+			}
+			// a comma here separates arguments
+			arg, err := p.assignment()
+			if err != nil {
+				return arg, err
+			}
+			args = append(args, arg)
+			if !p.match(scanner.COMMA) {
+				break
+			}
+		}
+	}
+
+	paren, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after arguments")
+	if err != nil {
+		return nil, err
+	}
+
+	return Call{Callee: callee, Paren: paren, Arguments: args}, nil
 }
 
 func (p *Parser) primary() (Expr, error) {
+	mark := p.mark()
 	if p.match(scanner.FALSE) {
+		p.wrap("Literal", mark)
 		return Literal{false}, nil
 	}
 	if p.match(scanner.TRUE) {
+		p.wrap("Literal", mark)
 		return Literal{true}, nil
 	}
 	if p.match(scanner.NIL) {
+		p.wrap("Literal", mark)
 		return Literal{nil}, nil
 	}
 
+	// the rest of a string after an interpolation starts with its "}", it's not an expression.
+	// Like in "${}", where there's nothing in between
+	if p.check(scanner.STRING) || p.check(scanner.INTERPOLATION) {
+		if strings.HasPrefix(p.peek().Lexeme, "}") {
+			return nil, p.error(p.peek(), "expect expression")
+		}
+	}
+
 	if p.match(scanner.NUMBER, scanner.STRING) {
+		p.wrap("Literal", mark)
 		return Literal{p.previous().Literal}, nil
 	}
 
+	if p.match(scanner.INTERPOLATION) {
+		expr, err := p.interpolation()
+		if err == nil {
+			p.wrap("Interpolation", mark)
+		}
+		return expr, err
+	}
+
+	if p.match(scanner.SUPER) {
+		keyword := p.previous()
+		if _, err := p.consume(scanner.DOT, "Expect '.' after 'super'"); err != nil {
+			return nil, err
+		}
+		method, err := p.consume(scanner.IDENTIFIER, "Expect superclass method name")
+		if err != nil {
+			return nil, err
+		}
+		p.wrap("Super", mark)
+		return &Super{Keyword: keyword, Method: method}, nil
+	}
+
+	if p.match(scanner.THIS) {
+		p.wrap("This", mark)
+		return &This{p.previous()}, nil
+	}
+
+	if p.match(scanner.IDENTIFIER) {
+		p.wrap("Variable", mark)
+		return &Variable{p.previous()}, nil
+	}
+
+	if p.match(scanner.FUN) {
+		expr, err := p.lambda()
+		if err == nil {
+			p.wrap("Lambda", mark)
+		}
+		return expr, err
+	}
+
+	// the arrow has to be looked for before the "(" is taken for a grouping
+	if p.check(scanner.LEFT_PAREN) && p.arrowAhead() {
+		p.advance()
+		expr, err := p.arrow()
+		if err == nil {
+			p.wrap("Lambda", mark)
+		}
+		return expr, err
+	}
+
 	if p.match(scanner.LEFT_PAREN) {
 		expr, err := p.expr()
 		if err != nil {
 			return expr, err
 		}
-		p.consume(scanner.RIGHT_PAREN, "Expect ')' after expression")
+		if _, err := p.consume(scanner.RIGHT_PAREN, "Expect ')' after expression"); err != nil {
+			return nil, err
+		}
+		p.wrap("Grouping", mark)
 		return Grouping{expr}, nil
 	}
 
 	return nil, p.error(p.peek(), "expect expression")
 }
 
+// lambda is called with the "fun" consumed
+func (p *Parser) lambda() (Expr, error) {
+	keyword := p.previous()
+	if _, err := p.consume(scanner.LEFT_PAREN, "Expect '(' after 'fun'"); err != nil {
+		return nil, err
+	}
+	params, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(scanner.LEFT_BRACE, "Expect '{' before lambda body"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return Lambda{Function{Name: lambdaName(keyword), Params: params, Body: body}}, nil
+}
+
+// arrow is called with the "(" consumed, the body is a block or an expression that's returned
+func (p *Parser) arrow() (Expr, error) {
+	paren := p.previous()
+	params, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+	arrow, err := p.consume(scanner.ARROW, "Expect '=>' after parameters")
+	if err != nil {
+		return nil, err
+	}
+
+	var body []Stmt
+	if p.match(scanner.LEFT_BRACE) {
+		if body, err = p.block(); err != nil {
+			return nil, err
+		}
+	} else {
+		// a comma after the body belongs to the enclosing expression, like in arguments
+		value, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		body = []Stmt{Return{Keyword: arrow, Value: value}}
+	}
+	return Lambda{Function{Name: lambdaName(paren), Params: params, Body: body}}, nil
+}
+
+// arrowAhead tells "(a, b) =>" from a grouping, without consuming anything
+func (p *Parser) arrowAhead() bool {
+	n := 1
+	if p.peekAt(n).Type != scanner.RIGHT_PAREN {
+		for p.peekAt(n).Type == scanner.IDENTIFIER {
+			n++
+			if p.peekAt(n).Type != scanner.COMMA {
+				break
+			}
+			n++
+		}
+	}
+	return p.peekAt(n).Type == scanner.RIGHT_PAREN && p.peekAt(n+1).Type == scanner.ARROW
+}
+
+// lambdaName is what a lambda is called in tracebacks, it's put where the lambda starts
+func lambdaName(start scanner.Token) scanner.Token {
+	return scanner.Token{
+		Type:   scanner.IDENTIFIER,
+		Lexeme: "<lambda>",
+		Line:   start.Line,
+		Column: start.Column,
+		Start:  start.Start,
+		End:    start.End,
+	}
+}
+
+// interpolation is called with the first INTERPOLATION token consumed,
+// empty string parts are left out
+func (p *Parser) interpolation() (Expr, error) {
+	var parts []Expr
+	for {
+		if text := p.previous().Literal.(string); text != "" {
+			parts = append(parts, Literal{text})
+		}
+
+		expr, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if p.match(scanner.INTERPOLATION) {
+			continue
+		}
+		// the rest of the string starts with the "}" closing the interpolation
+		if !p.check(scanner.STRING) || !strings.HasPrefix(p.peek().Lexeme, "}") {
+			return nil, p.error(p.peek(), "Expect '}' after interpolated expression")
+		}
+		if text := p.advance().Literal.(string); text != "" {
+			parts = append(parts, Literal{text})
+		}
+		return Interpolation{Parts: parts}, nil
+	}
+}
+
 // ===========================================
 // helpers
 // ===========================================
@@ -183,14 +991,64 @@ func (p *Parser) consume(tokenType scanner.TokenType, msg string) (scanner.Token
 }
 
 func (p *Parser) error(token scanner.Token, msg string) error {
-	if token.Type == scanner.EOF {
-		errorhandle.Report(token.Line, " at end", msg)
-	} else {
-		errorhandle.Report(token.Line, "at '"+token.Lexeme+"'", msg)
+	if suggestion, typo, ok := p.misspelledKeyword(token); ok {
+		msg = fmt.Sprintf("%s, did you mean '%s' instead of '%s'?", msg, suggestion, typo)
 	}
+
+	p.reporter.Report(errorhandle.Diagnostic{
+		Severity: errorhandle.ERROR,
+		Stage:    errorhandle.PARSE,
+		Line:     token.Line,
+		Column:   token.Column,
+		Start:    token.Start,
+		End:      token.End,
+		Message:  msg,
+		Token:    token.Lexeme,
+	})
 	return ParseError
 }
 
+// misspelledKeyword looks at the identifier a statement starts with, a typo like "retrun x;"
+// parses as an expression and fails on the token right after it. A typo like "whle (x) {}"
+// fails right after the parenthesized part instead, there only keywords taking one are suggested
+func (p *Parser) misspelledKeyword(token scanner.Token) (suggestion, typo string, ok bool) {
+	if p.stmtStart+1 >= len(p.tokens) || p.tokens[p.stmtStart].Type != scanner.IDENTIFIER {
+		return "", "", false
+	}
+	candidate := p.tokens[p.stmtStart]
+
+	keywords, next := scanner.Keywords(), p.stmtStart+1
+	if p.tokens[next].Type == scanner.LEFT_PAREN && p.tokens[next].Start != token.Start {
+		keywords = []string{"for", "if", "while"}
+		if next = p.closingParen(next) + 1; next >= len(p.tokens) {
+			return "", "", false
+		}
+	}
+	if p.tokens[next].Start != token.Start {
+		return "", "", false
+	}
+	if suggestion, ok := utils.Suggest(candidate.Lexeme, keywords); ok {
+		return suggestion, candidate.Lexeme, true
+	}
+	return "", "", false
+}
+
+// closingParen is the index of the ")" matching the "(" at open, past the end when it isn't there
+func (p *Parser) closingParen(open int) int {
+	depth := 0
+	for i := open; i < len(p.tokens); i++ {
+		switch p.tokens[i].Type {
+		case scanner.LEFT_PAREN:
+			depth++
+		case scanner.RIGHT_PAREN:
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(p.tokens)
+}
+
 func (p *Parser) match(types ...scanner.TokenType) bool {
 	for _, t := range types {
 		if p.check(t) {
@@ -208,13 +1066,53 @@ func (p *Parser) check(t scanner.TokenType) bool {
 	return p.peek().Type == t
 }
 
+// Err is the error from the token source, parsing stops there as if the input ended
+func (p *Parser) Err() error {
+	return p.err
+}
+
 func (p *Parser) peek() scanner.Token {
+	p.fill(p.current)
 	return p.tokens[p.current]
 }
 
+// fill pulls tokens from the source until there's one at index i,
+// the parser never goes past EOF so it's the last one pulled
+func (p *Parser) fill(i int) {
+	for p.source != nil && len(p.tokens) <= i {
+		token, err := p.source.Next()
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+		p.tokens = append(p.tokens, token)
+	}
+}
+
+// discard drops the tokens of the statements already parsed, but the last one for previous()
+func (p *Parser) discard() {
+	if p.source == nil || p.current < 2 {
+		return
+	}
+	p.tokens = p.tokens[p.current-1:]
+	p.current = 1
+}
+
+// peekAt looks n tokens ahead, past the end it's the EOF
+func (p *Parser) peekAt(n int) scanner.Token {
+	i := p.current + n
+	p.fill(i)
+	if i >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[i]
+}
+
 func (p *Parser) advance() scanner.Token {
 	if !p.isAtEnd() {
 		p.current++
+		if p.tree != nil {
+			p.tree.Children = append(p.tree.Children, p.previous())
+		}
 	}
 	return p.previous()
 }
@@ -236,7 +1134,8 @@ func (p *Parser) sync() {
 		}
 
 		switch p.peek().Type {
-		case scanner.CLASS, scanner.FUN, scanner.VAR, scanner.FOR, scanner.IF, scanner.WHILE, scanner.PRINT, scanner.RETURN:
+		case scanner.CLASS, scanner.FUN, scanner.VAR, scanner.FOR, scanner.IF, scanner.WHILE, scanner.PRINT, scanner.RETURN,
+			scanner.THROW, scanner.TRY:
 			return
 		default:
 			p.advance()
@@ -1,13 +1,16 @@
 package parser
 
 import (
+    "dexianta/glox/errorhandle"
     "dexianta/glox/scanner"
+    "fmt"
     "github.com/stretchr/testify/assert"
+    "strings"
     "testing"
 )
 
 func TestParser_Parse(t *testing.T) {
-    // (1 + 2) * (3 - 5)
+    // (1 + 2) * (3 - 5);
     tokens := []scanner.Token{
         {
             Type:    scanner.LEFT_PAREN,
@@ -16,7 +19,7 @@ func TestParser_Parse(t *testing.T) {
         {
             Type:    scanner.NUMBER,
             Lexeme:  "1",
-            Literal: float64(1),
+            Literal: int64(1),
         },
         {
             Type:    scanner.PLUS,
@@ -25,7 +28,7 @@ func TestParser_Parse(t *testing.T) {
         {
             Type:    scanner.NUMBER,
             Lexeme:  "2",
-            Literal: float64(2),
+            Literal: int64(2),
         },
         {
             Type:    scanner.RIGHT_PAREN,
@@ -42,7 +45,7 @@ func TestParser_Parse(t *testing.T) {
         {
             Type:    scanner.NUMBER,
             Lexeme:  "3",
-            Literal: float64(3),
+            Literal: int64(3),
         },
         {
             Type:    scanner.MINUS,
@@ -51,41 +54,395 @@ func TestParser_Parse(t *testing.T) {
         {
             Type:    scanner.NUMBER,
             Lexeme:  "5",
-            Literal: float64(5),
+            Literal: int64(5),
         },
         {
             Type:    scanner.RIGHT_PAREN,
             Lexeme:  ")",
         },
+        {
+            Type:    scanner.SEMICOLON,
+            Lexeme:  ";",
+        },
         {
             Type: scanner.EOF,
         },
     }
-    parser := NewParser(tokens)
-    expr := parser.Parse()
+    parser := NewParser(tokens, errorhandle.NewReporter(""))
+    stmts := parser.Parse()
 
     expected := Binary{
         Left:
             Grouping{Binary{
-            Left:     Literal{Value: float64(1)},
+            Left:     Literal{Value: int64(1)},
             Operator: scanner.Token{
                 Type:    scanner.PLUS,
                 Lexeme:  "+",
             },
-            Right:    Literal{Value: float64(2)},
+            Right:    Literal{Value: int64(2)},
         }},
         Operator: scanner.Token{
             Type:    scanner.STAR,
             Lexeme:  "*",
         },
         Right: Grouping{Binary{
-            Left:     Literal{Value: float64(3)},
+            Left:     Literal{Value: int64(3)},
             Operator: scanner.Token{
                 Type:    scanner.MINUS,
                 Lexeme:  "-",
             },
-            Right:    Literal{Value: float64(5)},
+            Right:    Literal{Value: int64(5)},
+        }},
+    }
+    assert.Equal(t, []Stmt{Expression{expected}}, stmts)
+}
+
+func parse(source string) ([]Stmt, *errorhandle.Reporter) {
+    reporter := errorhandle.NewReporter(source)
+    s := scanner.NewScanner(source, reporter)
+    parser := NewParser(s.ScanTokens(), reporter)
+    return parser.Parse(), reporter
+}
+
+// token builds a token scanned from a single line source
+func token(t scanner.TokenType, lexeme string, start int) scanner.Token {
+    return scanner.Token{Type: t, Lexeme: lexeme, Line: 1, Column: start + 1, Start: start, End: start + len(lexeme)}
+}
+
+func TestParser_Var(t *testing.T) {
+    stmts, _ := parse("var a = 1; { a = b = 2; }")
+
+    expected := []Stmt{
+        Var{Name: token(scanner.IDENTIFIER, "a", 4), Initializer: Literal{Value: int64(1)}},
+        Block{Statements: []Stmt{
+            Expression{&Assign{
+                Name:  token(scanner.IDENTIFIER, "a", 13),
+                Value: &Assign{Name: token(scanner.IDENTIFIER, "b", 17), Value: Literal{Value: int64(2)}},
+            }},
+        }},
+    }
+    assert.Equal(t, expected, stmts)
+}
+
+func TestParser_For(t *testing.T) {
+    stmts, _ := parse("for (var i = 0; i < 1; i = 1) print i;")
+
+    expected := []Stmt{
+        Block{Statements: []Stmt{
+            Var{Name: token(scanner.IDENTIFIER, "i", 9), Initializer: Literal{Value: int64(0)}},
+            While{
+                Condition: Binary{
+                    Left:     &Variable{token(scanner.IDENTIFIER, "i", 16)},
+                    Operator: token(scanner.LESS, "<", 18),
+                    Right:    Literal{Value: int64(1)},
+                },
+                Body: Block{Statements: []Stmt{
+                    Print{&Variable{token(scanner.IDENTIFIER, "i", 36)}},
+                    Expression{&Assign{Name: token(scanner.IDENTIFIER, "i", 23), Value: Literal{Value: int64(1)}}},
+                }},
+            },
         }},
     }
-    assert.Equal(t, expected, expr)
+    assert.Equal(t, expected, stmts)
+}
+
+func TestParser_Recovery(t *testing.T) {
+    source := "var = 1;\nprint 1;\n{ print 2 +; print 3; }\nfun f( {}\nprint 4;"
+    stmts, reporter := parse(source)
+
+    var messages []string
+    for _, d := range reporter.Diagnostics() {
+        messages = append(messages, fmt.Sprintf("%d: %s", d.Line, d.Message))
+    }
+    assert.Equal(t, []string{
+        "1: Expect variable name",
+        "3: expect expression",
+        "4: Expect parameter name",
+    }, messages)
+
+    assert.Equal(t, []Stmt{
+        Print{Literal{Value: int64(1)}},
+        Block{Statements: []Stmt{Print{Literal{Value: int64(3)}}}},
+        Print{Literal{Value: int64(4)}},
+    }, stmts)
+}
+
+func TestParser_MisspelledKeyword(t *testing.T) {
+    for source, hint := range map[string]string{
+        "fucn f() {}":        "did you mean 'fun' instead of 'fucn'?",
+        "fucn foo() {}":      "did you mean 'fun' instead of 'fucn'?",
+        "fucn add(a, b) {}":  "did you mean 'fun' instead of 'fucn'?",
+        "retrun 1;":          "did you mean 'return' instead of 'retrun'?",
+        "whle (true) {}":     "did you mean 'while' instead of 'whle'?",
+        "{ whle (true) {} }": "did you mean 'while' instead of 'whle'?",
+    } {
+        _, reporter := parse(source)
+        if assert.NotEmpty(t, reporter.Diagnostics(), source) {
+            assert.Contains(t, reporter.Diagnostics()[0].Message, hint)
+        }
+    }
+
+    // an identifier that isn't where a keyword goes is left alone
+    for _, source := range []string{"print foo bar;", "add(a, b) c;"} {
+        _, reporter := parse(source)
+        if assert.Len(t, reporter.Diagnostics(), 1, source) {
+            assert.NotContains(t, reporter.Diagnostics()[0].Message, "did you mean")
+        }
+    }
+}
+
+func TestParser_Try(t *testing.T) {
+    stmts, _ := parse("try { throw 1; } catch (e) {} finally {}")
+    e := token(scanner.IDENTIFIER, "e", 24)
+    assert.Equal(t, []Stmt{
+        Try{
+            Body:      []Stmt{Throw{Keyword: token(scanner.THROW, "throw", 6), Value: Literal{Value: int64(1)}}},
+            CatchName: &e,
+        },
+    }, stmts)
+
+    _, reporter := parse("try {}")
+    if assert.Len(t, reporter.Diagnostics(), 1) {
+        assert.Equal(t, "Expect 'catch' or 'finally' after try block", reporter.Diagnostics()[0].Message)
+    }
+}
+
+func TestParser_Interpolation(t *testing.T) {
+    stmts, _ := parse(`print "x ${a}${b}!";`)
+    assert.Equal(t, []Stmt{
+        Print{Expression: Interpolation{Parts: []Expr{
+            Literal{Value: "x "},
+            &Variable{Name: token(scanner.IDENTIFIER, "a", 11)},
+            &Variable{Name: token(scanner.IDENTIFIER, "b", 15)},
+            Literal{Value: "!"},
+        }}},
+    }, stmts)
+
+    for _, source := range []string{`"a${}b";`, `"a${}${b}c";`} {
+        _, reporter := parse(source)
+        if assert.Len(t, reporter.Diagnostics(), 1, source) {
+            assert.Equal(t, "expect expression", reporter.Diagnostics()[0].Message)
+            assert.Equal(t, 4, reporter.Diagnostics()[0].Start)
+        }
+    }
+}
+
+func TestParser_Stream(t *testing.T) {
+    source := "var a = 1;\nprint a +;\nfun f(x) { return \"${x}\"; }\nprint f(a);"
+    reporter := errorhandle.NewReporter(source)
+    s := scanner.NewScanner(source, reporter)
+    parser := NewParser(s.ScanTokens(), reporter)
+    expected := parser.Parse()
+
+    streamReporter := errorhandle.NewReporter(source)
+    stream := scanner.NewReaderScanner(strings.NewReader(source), streamReporter)
+    streamParser := NewStreamParser(&stream, streamReporter)
+    assert.Equal(t, expected, streamParser.Parse())
+    assert.Equal(t, reporter.Diagnostics(), streamReporter.Diagnostics())
+    assert.Nil(t, streamParser.Err())
+    // only the last statement's tokens are still held
+    assert.Less(t, len(streamParser.tokens), 10)
+}
+
+func TestParser_ParseTree(t *testing.T) {
+    t.Run("prints back the source", func(t *testing.T) {
+        for _, source := range []string{
+            "",
+            "// just a comment",
+            "var größe = 1; // trailing 😀\n\n/* leading\n block */ print größe  +  2 ;\n",
+            "class A < B {\n  init(x) { this.x = x; }\n  get() { return super.get() * -x; }\n}\n",
+            "fun f(a, b) {\n\tfor (var i = 0; i < 10; i = i + 1) { if (a and !b) print i; else {} }\n}\n",
+            "try { throw \"${a + 1} and ${ \"${b}\" }\"; } catch (e) { while (true) e.x = 1; } finally {}\r\n",
+            "print 1 +;\nvar = 2;\nprint @ 3;\n1 = 2;\n\"unterminated",
+            "print \"a ${b",
+            "var f = (a, b) => a + b; // arrow\nfun (x) { return x ? -x : x++; }(1), g(() => { return; });",
+        } {
+            reporter := errorhandle.NewReporter(source)
+            s := scanner.NewScanner(source, reporter)
+            s.KeepTrivia()
+            parser := NewParser(s.ScanTokens(), reporter)
+            _, tree := parser.ParseTree()
+            assert.Equal(t, source, tree.String())
+        }
+    })
+
+    t.Run("nodes", func(t *testing.T) {
+        source := "a = 1 + 2 * 3; // sum\n"
+        s := scanner.NewScanner(source, errorhandle.NewReporter(source))
+        s.KeepTrivia()
+        parser := NewParser(s.ScanTokens(), errorhandle.NewReporter(source))
+        stmts, tree := parser.ParseTree()
+        assert.Len(t, stmts, 1)
+
+        assert.Equal(t, "Program", tree.Kind)
+        assert.Len(t, tree.Children, 2)
+        stmt := tree.Children[0].(*Node)
+        assert.Equal(t, "Expression", stmt.Kind)
+        assign := stmt.Children[0].(*Node)
+        assert.Equal(t, "Assign", assign.Kind)
+        assert.Equal(t, "a = 1 + 2 * 3", assign.String())
+        sum := assign.Children[2].(*Node)
+        assert.Equal(t, "Binary", sum.Kind)
+        assert.Equal(t, "2 * 3", sum.Children[2].(*Node).String())
+
+        semicolon := stmt.Children[1].(scanner.Token)
+        assert.Equal(t, []scanner.Trivia{
+            {Kind: scanner.WHITESPACE, Text: " ", Start: 14, End: 15},
+            {Kind: scanner.LINE_COMMENT, Text: "// sum", Start: 15, End: 21},
+        }, semicolon.Trailing)
+        eof := tree.Children[1].(scanner.Token)
+        assert.Equal(t, []scanner.Trivia{{Kind: scanner.NEWLINE, Text: "\n", Start: 21, End: 22}}, eof.Leading)
+    })
+}
+
+func TestParser_Conditional(t *testing.T) {
+    stmts, _ := parse("a ? 1 : b ? 2 : 3, f(4, 5);")
+    assert.Equal(t, []Stmt{
+        Expression{Expression: Binary{
+            Left: Conditional{
+                Condition:  &Variable{Name: token(scanner.IDENTIFIER, "a", 0)},
+                ThenBranch: Literal{Value: int64(1)},
+                ElseBranch: Conditional{
+                    Condition:  &Variable{Name: token(scanner.IDENTIFIER, "b", 8)},
+                    ThenBranch: Literal{Value: int64(2)},
+                    ElseBranch: Literal{Value: int64(3)},
+                },
+            },
+            Operator: token(scanner.COMMA, ",", 17),
+            Right: Call{
+                Callee:    &Variable{Name: token(scanner.IDENTIFIER, "f", 19)},
+                Paren:     token(scanner.RIGHT_PAREN, ")", 25),
+                Arguments: []Expr{Literal{Value: int64(4)}, Literal{Value: int64(5)}},
+            },
+        }},
+    }, stmts)
+
+    _, reporter := parse("a ? 1;")
+    if assert.Len(t, reporter.Diagnostics(), 1) {
+        assert.Equal(t, "Expect ':' after then branch of conditional expression", reporter.Diagnostics()[0].Message)
+    }
+}
+
+func TestParser_Update(t *testing.T) {
+    stmts, _ := parse("a += 1; ++a.b; a--;")
+    assert.Equal(t, []Stmt{
+        Expression{Expression: Update{
+            Target:   &Variable{Name: token(scanner.IDENTIFIER, "a", 0)},
+            Operator: token(scanner.PLUS_EQUAL, "+=", 2),
+            Value:    Literal{Value: int64(1)},
+        }},
+        Expression{Expression: Update{
+            Target:   Get{Object: &Variable{Name: token(scanner.IDENTIFIER, "a", 10)}, Name: token(scanner.IDENTIFIER, "b", 12)},
+            Operator: token(scanner.PLUS_PLUS, "++", 8),
+            Value:    Literal{Value: int64(1)},
+        }},
+        Expression{Expression: Update{
+            Target:   &Variable{Name: token(scanner.IDENTIFIER, "a", 15)},
+            Operator: token(scanner.MINUS_MINUS, "--", 16),
+            Value:    Literal{Value: int64(1)},
+            Postfix:  true,
+        }},
+    }, stmts)
+
+    _, reporter := parse("1++;")
+    if assert.Len(t, reporter.Diagnostics(), 1) {
+        assert.Equal(t, "Invalid assignment target", reporter.Diagnostics()[0].Message)
+    }
+}
+
+func TestParser_Lambda(t *testing.T) {
+    stmts, _ := parse("(a) => a; (b);")
+    a := token(scanner.IDENTIFIER, "a", 1)
+    assert.Equal(t, []Stmt{
+        Expression{Expression: Lambda{Function{
+            Name:   scanner.Token{Type: scanner.IDENTIFIER, Lexeme: "<lambda>", Line: 1, Column: 1, Start: 0, End: 1},
+            Params: []scanner.Token{a},
+            Body:   []Stmt{Return{Keyword: token(scanner.ARROW, "=>", 4), Value: &Variable{Name: token(scanner.IDENTIFIER, "a", 7)}}},
+        }}},
+        Expression{Expression: Grouping{&Variable{Name: token(scanner.IDENTIFIER, "b", 11)}}},
+    }, stmts)
+
+    stmts, _ = parse("fun () {}; fun f() {}")
+    assert.IsType(t, Expression{}, stmts[0])
+    assert.IsType(t, Function{}, stmts[1])
+}
+
+func TestParser_Operators(t *testing.T) {
+    operators := NewOperators()
+    assert.Nil(t, operators.AddBinary("**", PREC_UNARY+5, RIGHT))
+    assert.Nil(t, operators.AddBinary("+", PREC_FACTOR+1, LEFT))
+    assert.Nil(t, operators.AddPrefix("#", PREC_UNARY))
+    assert.Equal(t, []string{"**", "#"}, operators.Symbols())
+
+    source := "-a ** b ** c; a * b + c; #a + b;"
+    reporter := errorhandle.NewReporter(source)
+    s := scanner.NewScanner(source, reporter)
+    s.AddOperators(operators.Symbols()...)
+    parser := NewParser(s.ScanTokens(), reporter)
+    parser.SetOperators(operators)
+    stmts := parser.Parse()
+    assert.Nil(t, reporter.Err())
+
+    variable := func(name string, start int) Expr {
+        return &Variable{Name: token(scanner.IDENTIFIER, name, start)}
+    }
+    assert.Equal(t, []Stmt{
+        Expression{Expression: Unary{
+            Operator: token(scanner.MINUS, "-", 0),
+            Right: Binary{
+                Left:     variable("a", 1),
+                Operator: token("**", "**", 3),
+                Right:    Binary{Left: variable("b", 6), Operator: token("**", "**", 8), Right: variable("c", 11)},
+            },
+        }},
+        Expression{Expression: Binary{
+            Left:     variable("a", 14),
+            Operator: token(scanner.STAR, "*", 16),
+            Right:    Binary{Left: variable("b", 18), Operator: token(scanner.PLUS, "+", 20), Right: variable("c", 22)},
+        }},
+        Expression{Expression: Binary{
+            Left:     Unary{Operator: token("#", "#", 25), Right: variable("a", 26)},
+            Operator: token(scanner.PLUS, "+", 28),
+            Right:    variable("b", 30),
+        }},
+    }, stmts)
+
+    assert.EqualError(t, operators.AddBinary("<|", PREC_NONE, LEFT), "operator '<|' has precedence 0, it has to be above PREC_NONE")
+    assert.NotNil(t, operators.AddPrefix("~", PREC_NONE))
+    assert.Equal(t, []string{"**", "#"}, operators.Symbols())
+}
+
+func TestParser_WordOperators(t *testing.T) {
+    operators := NewOperators()
+    assert.Nil(t, operators.AddBinary("in", PREC_COMPARISON, LEFT))
+    assert.Nil(t, operators.AddPrefix("not", PREC_AND+1))
+
+    source := "not a in b == c; o.in = o.in;"
+    reporter := errorhandle.NewReporter(source)
+    s := scanner.NewScanner(source, reporter)
+    s.AddOperators(operators.Symbols()...)
+    parser := NewParser(s.ScanTokens(), reporter)
+    parser.SetOperators(operators)
+    stmts := parser.Parse()
+    assert.Nil(t, reporter.Err())
+
+    variable := func(name string, start int) Expr {
+        return &Variable{Name: token(scanner.IDENTIFIER, name, start)}
+    }
+    // "not" takes all of "a in b == c", and "in" after a "." is a property
+    assert.Equal(t, []Stmt{
+        Expression{Expression: Unary{
+            Operator: token("not", "not", 0),
+            Right: Binary{
+                Left:     Binary{Left: variable("a", 4), Operator: token("in", "in", 6), Right: variable("b", 9)},
+                Operator: token(scanner.EQUAL_EQUAL, "==", 11),
+                Right:    variable("c", 14),
+            },
+        }},
+        Expression{Expression: Set{
+            Object: variable("o", 17),
+            Name:   token(scanner.IDENTIFIER, "in", 19),
+            Value:  Get{Object: variable("o", 24), Name: token(scanner.IDENTIFIER, "in", 26)},
+        }},
+    }, stmts)
 }
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"dexianta/glox/scanner"
+)
+
+type Stmt interface {
+	//isStmt()
+}
+
+// ========================= //
+// 			statement
+// ========================= //
+
+type Expression struct {
+	Expression Expr
+}
+
+func (e Expression) isStmt() {}
+
+// ========================= //
+
+type Print struct {
+	Expression Expr
+}
+
+func (p Print) isStmt() {}
+
+// ========================= //
+
+type Var struct {
+	Name        scanner.Token
+	Initializer Expr
+}
+
+func (v Var) isStmt() {}
+
+// ========================= //
+
+type Block struct {
+	Statements []Stmt
+}
+
+func (b Block) isStmt() {}
+
+// ========================= //
+
+type If struct {
+	Condition  Expr
+	ThenBranch Stmt
+	ElseBranch Stmt
+}
+
+func (i If) isStmt() {}
+
+// ========================= //
+
+type While struct {
+	Condition Expr
+	Body      Stmt
+}
+
+func (w While) isStmt() {}
+
+// ========================= //
+
+type Function struct {
+	Name   scanner.Token
+	Params []scanner.Token
+	Body   []Stmt
+}
+
+func (f Function) isStmt() {}
+
+// ========================= //
+
+type Return struct {
+	Keyword scanner.Token
+	Value   Expr
+}
+
+func (r Return) isStmt() {}
+
+// ========================= //
+
+type Class struct {
+	Name       scanner.Token
+	Superclass *Variable // nil if the class doesn't inherit
+	Methods    []Function
+}
+
+func (c Class) isStmt() {}
+
+// ========================= //
+
+type Throw struct {
+	Keyword scanner.Token
+	Value   Expr
+}
+
+func (t Throw) isStmt() {}
+
+// ========================= //
+
+// Try has a catch, a finally, or both. CatchName is nil when there's no catch clause
+type Try struct {
+	Body      []Stmt
+	CatchName *scanner.Token
+	Catch     []Stmt
+	Finally   []Stmt
+}
+
+func (t Try) isStmt() {}
@@ -3,7 +3,12 @@ package scanner
 import (
 	"dexianta/glox/errorhandle"
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type TokenType string
@@ -21,6 +26,9 @@ const (
 	SEMICOLON   TokenType = ";"
 	SLASH       TokenType = "/"
 	STAR        TokenType = "*"
+	PERCENT     TokenType = "%"
+	QUESTION    TokenType = "?"
+	COLON       TokenType = ":"
 
 	// one or two character tokens
 	BANG          TokenType = "!"
@@ -29,32 +37,48 @@ const (
 	EQUAL_EQUAL   TokenType = "=="
 	GREATER       TokenType = ">"
 	GREATER_EQUAL TokenType = ">="
-	LESS       TokenType = "<"
-	LESS_EQUAL TokenType = "<="
+	LESS          TokenType = "<"
+	LESS_EQUAL    TokenType = "<="
+	PLUS_EQUAL    TokenType = "+="
+	MINUS_EQUAL   TokenType = "-="
+	STAR_EQUAL    TokenType = "*="
+	SLASH_EQUAL   TokenType = "/="
+	PLUS_PLUS     TokenType = "++"
+	MINUS_MINUS   TokenType = "--"
+	ARROW         TokenType = "=>"
+	TILDE_SLASH   TokenType = "~/" // integer division
 
 	// literals
 	IDENTIFIER TokenType = "identifier"
 	STRING     TokenType = "string"
 	NUMBER     TokenType = "number"
 
+	// the part of a string up to a "${", the rest of the string comes as a STRING
+	// token starting with the "}" that closes the interpolation
+	INTERPOLATION TokenType = "interpolation"
+
 	// keywords
-	AND    TokenType = "and"
-	CLASS  TokenType = "class"
-	ELSE   TokenType = "else"
-	FALSE  TokenType = "false"
-	FUN    TokenType = "fun"
-	FOR    TokenType = "for"
-	IF     TokenType = "if"
-	NIL    TokenType = "nil"
-	OR     TokenType = "or"
-	PRINT  TokenType = "print"
-	RETURN TokenType = "return"
-	SUPER  TokenType = "super"
-	THIS   TokenType = "this"
-	TRUE   TokenType = "true"
-	VAR    TokenType = "var"
-	WHILE  TokenType = "while"
-	EOF    TokenType = "eof"
+	AND     TokenType = "and"
+	CLASS   TokenType = "class"
+	ELSE    TokenType = "else"
+	FALSE   TokenType = "false"
+	FUN     TokenType = "fun"
+	FOR     TokenType = "for"
+	IF      TokenType = "if"
+	NIL     TokenType = "nil"
+	OR      TokenType = "or"
+	PRINT   TokenType = "print"
+	RETURN  TokenType = "return"
+	SUPER   TokenType = "super"
+	THIS    TokenType = "this"
+	TRUE    TokenType = "true"
+	VAR     TokenType = "var"
+	WHILE   TokenType = "while"
+	THROW   TokenType = "throw"
+	TRY     TokenType = "try"
+	CATCH   TokenType = "catch"
+	FINALLY TokenType = "finally"
+	EOF     TokenType = "eof"
 )
 
 var keywords = map[string]TokenType{}
@@ -76,43 +100,271 @@ func init() {
 	keywords["true"] = TRUE
 	keywords["var"] = VAR
 	keywords["while"] = WHILE
+	keywords["throw"] = THROW
+	keywords["try"] = TRY
+	keywords["catch"] = CATCH
+	keywords["finally"] = FINALLY
+}
+
+// Keywords lists every reserved word
+func Keywords() []string {
+	var res []string
+	for keyword := range keywords {
+		res = append(res, keyword)
+	}
+	return res
 }
 
 type Token struct {
-	Type    TokenType   // token type
-	Lexeme  string      // the string representation
-	Literal interface{} // actual value of this token
-	Line    int
+	Type     TokenType   // token type
+	Lexeme   string      // the string representation
+	Literal  interface{} // actual value of this token
+	Line     int         // 1-based line the token starts on
+	Column   int         // 1-based column the token starts at
+	Start    int         // byte offset of the first character
+	End      int         // byte offset right after the last character
+	Leading  []Trivia    // trivia before the token, only kept in trivia mode
+	Trailing []Trivia    // trivia after the token up to the end of its line
+}
+
+// FullText is the lexeme with the trivia around it
+func (t Token) FullText() string {
+	var b strings.Builder
+	for _, trivia := range t.Leading {
+		b.WriteString(trivia.Text)
+	}
+	b.WriteString(t.Lexeme)
+	for _, trivia := range t.Trailing {
+		b.WriteString(trivia.Text)
+	}
+	return b.String()
+}
+
+type TriviaKind string
+
+const (
+	WHITESPACE    TriviaKind = "whitespace"
+	NEWLINE       TriviaKind = "newline"
+	LINE_COMMENT  TriviaKind = "line comment"
+	BLOCK_COMMENT TriviaKind = "block comment"
+	SKIPPED       TriviaKind = "skipped" // text the scanner reported an error for instead of making a token
+)
+
+// Trivia is source text that doesn't make a token, kept so tools can print the source back
+type Trivia struct {
+	Kind  TriviaKind
+	Text  string
+	Start int // byte offsets, like a token's
+	End   int
 }
 
 type Scanner struct {
-	Source  string
-	Tokens  []Token
-	start   int
-	current int
-	line    int
+	Source    string
+	Tokens    []Token
+	start     int
+	current   int
+	line      int
+	lineStart int // byte offset where the current line begins
+	colOffset int // the last offset a column was counted for, and its column
+	col       int
+	startLine int // line and column of the token being scanned
+	startCol  int
+	reporter  *errorhandle.Reporter
+
+	// one entry per "${" we are inside of, counting the braces opened in it
+	interpolations []int
+
+	pending []Token // scanned but not handed out by Next yet
+	ended   bool    // the end of the input was reached and eof added
+	eof     Token
+
+	// in trivia mode whitespace and comments are kept on the tokens,
+	// trivia collects them until the next token
+	keepTrivia bool
+	trivia     []Trivia
+	kept       bool // whether the text just scanned went into a token or trivia
+
+	// operators added on top of the built-in tokens, symbols are longest first
+	symbols [][]rune
+	words   map[string]TokenType
+
+	// a scanner reading from a stream only keeps Source from the token being scanned on,
+	// offset is where Source begins in the stream. Source is the text of buffer, it's read
+	// into without copying what's there. err is io.EOF once the reader is done
+	reader io.Reader
+	buffer *strings.Builder
+	chunk  []byte
+	offset int
+	err    error
+}
+
+// readSize is how much a streaming scanner reads at a time
+const readSize = 4096
+
+func NewScanner(source string, reporter *errorhandle.Reporter) Scanner {
+	return Scanner{Source: source, line: 1, col: 1, reporter: reporter}
 }
 
-func NewScanner(source string) Scanner {
-	return Scanner{Source: source}
+// NewReaderScanner scans the source as it's read, use Next to get the tokens as they come
+func NewReaderScanner(reader io.Reader, reporter *errorhandle.Reporter) Scanner {
+	return Scanner{reader: reader, buffer: &strings.Builder{}, line: 1, col: 1, reporter: reporter}
 }
 
+// KeepTrivia makes the scanner keep whitespace and comments on the tokens, together
+// the tokens' FullText is the source byte for byte
+func (s *Scanner) KeepTrivia() {
+	s.keepTrivia = true
+}
+
+// AddOperators makes the scanner give each symbol a token of its own, with the symbol as
+// the token type. A word like "in" becomes a keyword, other symbols are matched before the
+// built-in tokens, longest first, so "**" isn't scanned as two "*"
+func (s *Scanner) AddOperators(symbols ...string) {
+	for _, symbol := range symbols {
+		if first, _ := utf8.DecodeRuneInString(symbol); isAlpha(first) {
+			if s.words == nil {
+				s.words = map[string]TokenType{}
+			}
+			s.words[symbol] = TokenType(symbol)
+			continue
+		}
+		s.symbols = append(s.symbols, []rune(symbol))
+	}
+	sort.SliceStable(s.symbols, func(a, b int) bool {
+		return len(s.symbols[a]) > len(s.symbols[b])
+	})
+}
+
+// IsToken tells if text already scans as a token of its own, like "<=" or "and"
+func IsToken(text string) bool {
+	reporter := errorhandle.NewReporter(text)
+	s := NewScanner(text, reporter)
+	tokens := s.ScanTokens()
+	return !reporter.HadError() && len(tokens) == 2 && string(tokens[0].Type) == text
+}
+
+// ScanTokens scans all of the source, a failing reader ends it like the end of the source
 func (s *Scanner) ScanTokens() []Token {
-	for !s.IsAtEnd() {
+	for {
+		token, _ := s.Next()
+		s.Tokens = append(s.Tokens, token)
+		if token.Type == EOF {
+			return s.Tokens
+		}
+	}
+}
+
+// Next returns the tokens one at a time, EOF comes last and keeps coming after that.
+// The error is only from the reader, in which case the token is EOF. Problems in the
+// source itself go to the reporter
+func (s *Scanner) Next() (Token, error) {
+	// with trivia a token is held back until the next one is scanned, that's
+	// when the rest of its line is known
+	lookahead := 1
+	if s.keepTrivia {
+		lookahead = 2
+	}
+
+	for len(s.pending) < lookahead && !s.ended {
+		if s.IsAtEnd() {
+			s.end()
+			break
+		}
+		s.discard()
 		s.start = s.current
+		s.startLine = s.line
+		s.startCol = s.column(s.start)
+		s.kept = false
 		s.scanToken()
+		if !s.kept {
+			// an error dropped the text, it's still needed to print the source back
+			s.addTrivia(SKIPPED)
+		}
+	}
+
+	if len(s.pending) == 0 {
+		return s.eof, s.readErr()
 	}
+	token := s.pending[0]
+	s.pending = s.pending[1:]
+	if token.Type == EOF {
+		return token, s.readErr()
+	}
+	return token, nil
+}
 
-	s.Tokens = append(s.Tokens, Token{
-		Type:    EOF,
-		Lexeme:  "",
-		Literal: nil,
-		Line:    s.line})
+// end is called once the input runs out, it adds the EOF token
+func (s *Scanner) end() {
+	s.start = s.current
+	s.startLine = s.line
+	s.startCol = s.column(s.start)
+	if len(s.interpolations) != 0 {
+		s.error("", "unterminated string interpolation")
+	}
 
-	return s.Tokens
+	s.addToken(EOF, nil)
+	s.eof = s.pending[len(s.pending)-1]
+	s.ended = true
+}
+
+// readErr is the error the reader failed with, running out of input is not one
+func (s *Scanner) readErr() error {
+	if s.err == io.EOF {
+		return nil
+	}
+	return s.err
+}
+
+// discard drops the text already scanned, only a streaming scanner does it. It's called
+// between tokens so the token being scanned is always in Source. What's left is copied
+// to a new buffer, so that's only done once it's no more than what's dropped
+func (s *Scanner) discard() {
+	if s.reader == nil || s.current < readSize || s.current < len(s.Source)-s.current {
+		return
+	}
+	// the start of the line may go, columns are counted on from here
+	s.column(s.current)
+	rest := s.Source[s.current:]
+	s.buffer = &strings.Builder{}
+	s.buffer.WriteString(rest)
+	s.Source = s.buffer.String()
+
+	s.offset += s.current
+	s.lineStart -= s.current
+	s.colOffset -= s.current
+	s.current = 0
+}
+
+// fill reads from the reader until Source is n bytes long or the reader is done
+func (s *Scanner) fill(n int) {
+	if s.chunk == nil && s.reader != nil {
+		s.chunk = make([]byte, readSize)
+	}
+	for s.reader != nil && s.err == nil && len(s.Source) < n {
+		read, err := s.reader.Read(s.chunk)
+		s.buffer.Write(s.chunk[:read])
+		s.Source = s.buffer.String()
+		s.err = err
+	}
+}
+
+// longTokens is the built-in text longer than a character, a symbol added with AddOperators
+// is only scanned over it when it's longer, so adding "~" leaves "~/" alone
+var longTokens = []string{
+	string(BANG_EQUAL), string(EQUAL_EQUAL), string(ARROW), string(LESS_EQUAL), string(GREATER_EQUAL),
+	string(PLUS_EQUAL), string(MINUS_EQUAL), string(STAR_EQUAL), string(SLASH_EQUAL),
+	string(PLUS_PLUS), string(MINUS_MINUS), string(TILDE_SLASH), "//", "/*",
 }
 
 func (s *Scanner) scanToken() {
+	for _, symbol := range s.symbols {
+		if s.ahead(symbol...) && !s.longerToken(len(symbol)) {
+			s.match(symbol...)
+			s.addToken(TokenType(string(symbol)), nil)
+			return
+		}
+	}
+
 	c := s.advance()
 	switch c {
 	case '(':
@@ -120,19 +372,53 @@ func (s *Scanner) scanToken() {
 	case ')':
 		s.addToken(RIGHT_PAREN, nil)
 	case '{':
+		if n := len(s.interpolations); n != 0 {
+			s.interpolations[n-1]++
+		}
 		s.addToken(LEFT_BRACE, nil)
 	case '}':
+		if n := len(s.interpolations); n != 0 {
+			if s.interpolations[n-1] == 0 {
+				// closes the interpolation, the string goes on
+				s.interpolations = s.interpolations[:n-1]
+				s.string()
+				return
+			}
+			s.interpolations[n-1]--
+		}
 		s.addToken(RIGHT_BRACE, nil)
 	case ',':
 		s.addToken(COMMA, nil)
 	case '.':
 		s.addToken(DOT, nil)
 	case '-':
-		s.addToken(MINUS, nil)
+		if s.match('-') {
+			s.addToken(MINUS_MINUS, nil)
+		} else if s.match('=') {
+			s.addToken(MINUS_EQUAL, nil)
+		} else {
+			s.addToken(MINUS, nil)
+		}
 	case '+':
-		s.addToken(PLUS, nil)
+		if s.match('+') {
+			s.addToken(PLUS_PLUS, nil)
+		} else if s.match('=') {
+			s.addToken(PLUS_EQUAL, nil)
+		} else {
+			s.addToken(PLUS, nil)
+		}
 	case '*':
-		s.addToken(STAR, nil)
+		if s.match('=') {
+			s.addToken(STAR_EQUAL, nil)
+		} else {
+			s.addToken(STAR, nil)
+		}
+	case '%':
+		s.addToken(PERCENT, nil)
+	case '?':
+		s.addToken(QUESTION, nil)
+	case ':':
+		s.addToken(COLON, nil)
 	case ';':
 		s.addToken(SEMICOLON, nil)
 
@@ -146,6 +432,8 @@ func (s *Scanner) scanToken() {
 	case '=':
 		if s.match('=') {
 			s.addToken(EQUAL_EQUAL, nil)
+		} else if s.match('>') {
+			s.addToken(ARROW, nil)
 		} else {
 			s.addToken(EQUAL, nil)
 		}
@@ -164,27 +452,37 @@ func (s *Scanner) scanToken() {
 			s.addToken(GREATER, nil)
 		}
 
+	case '~':
+		if s.match('/') {
+			s.addToken(TILDE_SLASH, nil)
+		} else {
+			s.error(string(c), fmt.Sprintf("Unexpected character: %c", c))
+		}
+
 	case '/':
 		if s.match('/') {
-			for !equalBytes(s.peek(0), []byte{'\n'}) && !s.IsAtEnd() {
+			for s.peek(0) != '\n' && !s.IsAtEnd() {
 				s.advance()
 			}
+			s.addTrivia(LINE_COMMENT)
 		} else if s.match('*') {
 			for !s.match('*', '/') && !s.IsAtEnd() {
-				if equalBytes(s.peek(0), []byte{'\n'}) {
-					s.line++
+				if s.advance() == '\n' {
+					s.newline()
 				}
-				s.advance()
 			}
+			s.addTrivia(BLOCK_COMMENT)
+		} else if s.match('=') {
+			s.addToken(SLASH_EQUAL, nil)
 		} else {
 			s.addToken(SLASH, nil)
 		}
 
-	case ' ':
-	case '\r':
-	case '\t':
+	case ' ', '\r', '\t':
+		s.addTrivia(WHITESPACE)
 	case '\n':
-		s.line++
+		s.newline()
+		s.addTrivia(NEWLINE)
 	case '"':
 		s.string()
 
@@ -193,45 +491,40 @@ func (s *Scanner) scanToken() {
 			s.number()
 		} else if isAlpha(c) {
 			s.identifier()
+		} else if c == utf8.RuneError {
+			s.error(s.Source[s.start:s.current], "Invalid UTF-8 encoding")
 		} else {
-			errorhandle.Report(s.line, "", fmt.Sprintf("Unexpected character: %c", c))
-		}
-	}
-}
-
-func equalBytes(a []byte, b []byte) bool {
-	if len(a) != len(b) {
-		return false
-	}
-
-	for idx := range a {
-		if a[idx] != b[idx] {
-			return false
+			s.error(string(c), fmt.Sprintf("Unexpected character: %c", c))
 		}
 	}
-
-	return true
 }
 
-func isDigit(char byte) bool {
-	return char > '0' && char < '9'
+// isDigit only takes ascii digits, that's all a number literal is made of
+func isDigit(char rune) bool {
+	return char >= '0' && char <= '9'
 }
 
-func isAlpha(char byte) bool {
-	return (char > 'a' && char < 'z') || (char > 'A' && char < 'Z') || char == '_'
+// isAlpha takes a letter of any script, so identifiers can be written in any language
+func isAlpha(char rune) bool {
+	return unicode.IsLetter(char) || char == '_'
 }
 
-func isAlphaNumeric(c byte) bool {
-	return isDigit(c) || isAlpha(c)
+// isAlphaNumeric also takes digits of other scripts, and combining marks which some scripts
+// need to spell a word
+func isAlphaNumeric(c rune) bool {
+	return isAlpha(c) || unicode.IsDigit(c) || unicode.In(c, unicode.Mn, unicode.Mc)
 }
 
 func (s *Scanner) identifier() {
-	for len(s.peek(0)) != 0 && isAlphaNumeric(s.peek(0)[0]) {
+	for isAlphaNumeric(s.peek(0)) {
 		s.advance()
 	}
 
 	text := s.Source[s.start:s.current]
 	tokenType, ok := keywords[text]
+	if !ok {
+		tokenType, ok = s.words[text]
+	}
 	if !ok {
 		tokenType = IDENTIFIER
 	}
@@ -239,94 +532,346 @@ func (s *Scanner) identifier() {
 	s.addToken(tokenType, nil)
 }
 
+// number takes decimal, hex ("0x") and binary ("0b") literals, and "_" between digits.
+// whole numbers are int64, the ones with a fraction or an exponent are float64
 func (s *Scanner) number() {
-	for len(s.peek(0)) != 0 && isDigit(s.peek(0)[0]) {
-		s.advance()
+	if s.Source[s.start] == '0' && (s.match('x') || s.match('X')) {
+		s.integer(16, isHexDigit)
+		return
+	}
+	if s.Source[s.start] == '0' && (s.match('b') || s.match('B')) {
+		s.integer(2, isBinaryDigit)
+		return
 	}
 
-	if len(s.peek(0)) != 0 && s.peek(0)[0] == '.' && isDigit(s.peek(1)[1]) {
+	isFloat := false
+	s.digits(s.start, isDigit)
+	if s.peek(0) == '.' && isDigit(s.peek(1)) {
 		s.advance() // consume the "."
-
-		for len(s.peek(0)) != 0 && isDigit(s.peek(0)[0]) {
+		s.digits(s.current, isDigit)
+		isFloat = true
+	}
+	if (s.peek(0) == 'e' || s.peek(0) == 'E') &&
+		(isDigit(s.peek(1)) || (s.peek(1) == '+' || s.peek(1) == '-') && isDigit(s.peek(2))) {
+		s.advance() // consume the "e"
+		if s.peek(0) == '+' || s.peek(0) == '-' {
 			s.advance()
 		}
+		s.digits(s.current, isDigit)
+		isFloat = true
 	}
 
-	number, err := strconv.ParseFloat(s.Source[s.start:s.current], 64)
+	text := strings.ReplaceAll(s.Source[s.start:s.current], "_", "")
+	if isFloat {
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			s.error(s.Source[s.start:s.current], fmt.Sprintf("error handle parsing float: %s", err.Error()))
+		}
+		s.addToken(NUMBER, number)
+		return
+	}
+
+	number, err := strconv.ParseInt(text, 10, 64)
 	if err != nil {
-		errorhandle.Report(s.line, "",fmt.Sprintf("error handle parsing float: %s", err.Error()))
+		s.error(s.Source[s.start:s.current], fmt.Sprintf("Integer literal '%s' is out of range", s.Source[s.start:s.current]))
 	}
+	s.addToken(NUMBER, number)
+}
 
+// integer reads the digits after a "0x" or "0b" prefix
+func (s *Scanner) integer(base int, isDigit func(rune) bool) {
+	if !isDigit(s.peek(0)) && s.peek(0) != '_' {
+		s.error(s.Source[s.start:s.current], fmt.Sprintf("Expect digits after '%s'", s.Source[s.start:s.current]))
+		s.addToken(NUMBER, int64(0))
+		return
+	}
+	s.digits(s.current, isDigit)
+
+	lexeme := s.Source[s.start:s.current]
+	number, err := strconv.ParseInt(strings.ReplaceAll(lexeme[2:], "_", ""), base, 64)
+	if err != nil {
+		s.error(lexeme, fmt.Sprintf("Integer literal '%s' is out of range", lexeme))
+	}
 	s.addToken(NUMBER, number)
 }
 
-// string by default is multiline string
+// digits consumes a run of digits starting at from, a "_" is only allowed between two digits
+func (s *Scanner) digits(from int, isDigit func(rune) bool) {
+	for isDigit(s.peek(0)) || s.peek(0) == '_' {
+		s.advance()
+	}
+
+	run := s.Source[from:s.current]
+	if strings.HasPrefix(run, "_") || strings.HasSuffix(run, "_") || strings.Contains(run, "__") {
+		s.error(s.Source[s.start:s.current], "'_' must be between digits")
+	}
+}
+
+// string by default is multiline string, it stops early at a "${" and
+// picks up again at the "}" closing the interpolation
 func (s *Scanner) string() {
-	for !equalBytes(s.peek(0), []byte{'"'}) && !s.IsAtEnd() {
-		if equalBytes(s.peek(0), []byte{'\n'}) {
-			s.line++
+	var value strings.Builder
+	for s.peek(0) != '"' && !s.IsAtEnd() {
+		if s.match('$', '{') {
+			s.addToken(INTERPOLATION, value.String())
+			s.interpolations = append(s.interpolations, 0)
+			return
+		}
+
+		start := s.current
+		switch s.advance() {
+		case '\n':
+			s.newline()
+			value.WriteString(s.Source[start:s.current])
+		case '\\':
+			s.escape(start, &value)
+		default:
+			// copied as is, so text in any encoding is kept intact
+			value.WriteString(s.Source[start:s.current])
 		}
-		s.advance()
 	}
 
 	if s.IsAtEnd() {
-		errorhandle.Report(s.line, "", "unterminated string")
+		s.error("", "unterminated string")
 		return
 	}
 
 	s.advance() // the closing "
+	s.addToken(STRING, value.String())
+}
+
+var escapes = map[rune]rune{
+	'n':  '\n',
+	't':  '\t',
+	'r':  '\r',
+	'0':  0,
+	'"':  '"',
+	'\\': '\\',
+	'$':  '$',
+}
+
+// escape decodes the escape sequence that starts with the backslash at start
+func (s *Scanner) escape(start int, value *strings.Builder) {
+	if s.IsAtEnd() {
+		return // reported as an unterminated string
+	}
+
+	c := s.advance()
+	if r, ok := escapes[c]; ok {
+		value.WriteRune(r)
+		return
+	}
+	if c != 'u' {
+		s.errorAt(start, fmt.Sprintf("Invalid escape sequence '%s'", s.Source[start:s.current]))
+		return
+	}
+
+	// \u{1F600}, one to six hex digits
+	if !s.match('{') {
+		s.errorAt(start, "Expect '{' after '\\u'")
+		return
+	}
+	digits := s.current
+	for isHexDigit(s.peek(0)) {
+		s.advance()
+	}
+	hex := s.Source[digits:s.current]
+	if !s.match('}') || len(hex) == 0 || len(hex) > 6 {
+		s.errorAt(start, fmt.Sprintf("Invalid unicode escape '%s'", s.Source[start:s.current]))
+		return
+	}
+
+	code, _ := strconv.ParseInt(hex, 16, 32)
+	if !utf8.ValidRune(rune(code)) {
+		s.errorAt(start, fmt.Sprintf("Invalid unicode code point '%s'", s.Source[start:s.current]))
+		return
+	}
+	value.WriteRune(rune(code))
+}
+
+func isHexDigit(c rune) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
 
-	value := s.Source[s.start+1 : s.current-1] // remove the start & end quote
-	s.addToken(STRING, value)
+func isBinaryDigit(c rune) bool {
+	return c == '0' || c == '1'
 }
 
-//IsAtEnd represents there's no more character left to consume
+// IsAtEnd represents there's no more character left to consume
 func (s *Scanner) IsAtEnd() bool {
+	s.fill(s.current + 1)
 	return s.current >= len(s.Source)
 }
 
 func (s *Scanner) IsAtEndOffset(offset int) bool {
+	s.fill(s.current + offset + 1)
 	return s.current+offset >= len(s.Source)
 }
 
-func (s *Scanner) advance() byte {
-	idx := s.current
-	s.current++
-	return s.Source[idx]
+// advance consumes one utf-8 encoded character, an invalid byte comes back as utf8.RuneError
+func (s *Scanner) advance() rune {
+	r, size := s.decode(s.current)
+	s.current += size
+	return r
 }
 
-func (s *Scanner) peek(step int) (res []byte) {
-	if s.IsAtEndOffset(step) {
-		return
+// peek looks step characters ahead without consuming anything, it's 0 past the end
+func (s *Scanner) peek(step int) rune {
+	offset := s.current
+	for ; step > 0; step-- {
+		_, size := s.decode(offset)
+		if size == 0 {
+			return 0
+		}
+		offset += size
 	}
 
-	for i := s.current; i <= s.current+step; i++ {
-		res = append(res, s.Source[i])
+	r, size := s.decode(offset)
+	if size == 0 {
+		return 0
 	}
-	return
+	return r
 }
 
-func (s *Scanner) match(chars ...byte) bool {
-	if s.IsAtEnd() && s.IsAtEndOffset(len(chars)) {
-		return false
+// decode reads the character at a byte offset of Source, reading more of the stream if it's cut off.
+// Past the end it's utf8.RuneError with a size of 0
+func (s *Scanner) decode(offset int) (rune, int) {
+	s.fill(offset + 1)
+	if offset < len(s.Source) && !utf8.FullRuneInString(s.Source[offset:]) {
+		s.fill(offset + utf8.UTFMax)
+	}
+	if offset >= len(s.Source) {
+		return utf8.RuneError, 0
 	}
+	return utf8.DecodeRuneInString(s.Source[offset:])
+}
 
+// ahead tells if chars are next, without consuming them
+func (s *Scanner) ahead(chars ...rune) bool {
 	for idx, c := range chars {
-		if s.Source[s.current+idx] != c {
+		if s.peek(idx) != c {
 			return false
 		}
 	}
+	return true
+}
+
+// longerToken tells if a built-in token longer than n characters is next
+func (s *Scanner) longerToken(n int) bool {
+	for _, token := range longTokens {
+		if chars := []rune(token); len(chars) > n && s.ahead(chars...) {
+			return true
+		}
+	}
+	return false
+}
+
+// match consumes chars only if all of them are next
+func (s *Scanner) match(chars ...rune) bool {
+	if !s.ahead(chars...) {
+		return false
+	}
 
-	s.current += len(chars)
+	for range chars {
+		s.advance()
+	}
 	return true
 }
 
+// column is the 1-based column of a byte offset on the current line, counted in characters.
+// Counting goes on from the last offset asked for, so a long line isn't counted over and over
+func (s *Scanner) column(offset int) int {
+	// a streaming scanner may have dropped the line start, but then it's never asked about
+	// an offset before the token being scanned
+	if offset < s.colOffset {
+		s.colOffset, s.col = s.lineStart, 1
+	}
+	s.col += utf8.RuneCountInString(s.Source[s.colOffset:offset])
+	s.colOffset = offset
+	return s.col
+}
+
+// newline is called right after a '\n' is consumed
+func (s *Scanner) newline() {
+	s.line++
+	s.lineStart = s.current
+	s.colOffset, s.col = s.current, 1
+}
+
+// error reports a problem with the token being scanned
+func (s *Scanner) error(lexeme, msg string) {
+	s.reporter.Report(errorhandle.Diagnostic{
+		Severity: errorhandle.ERROR,
+		Stage:    errorhandle.SCAN,
+		Line:     s.startLine,
+		Column:   s.startCol,
+		Start:    s.offset + s.start,
+		End:      s.offset + s.current,
+		Message:  msg,
+		Token:    lexeme,
+	})
+}
+
+// errorAt reports a problem with the text from start to the current character, on the current line
+func (s *Scanner) errorAt(start int, msg string) {
+	s.reporter.Report(errorhandle.Diagnostic{
+		Severity: errorhandle.ERROR,
+		Stage:    errorhandle.SCAN,
+		Line:     s.line,
+		Column:   s.column(start),
+		Start:    s.offset + start,
+		End:      s.offset + s.current,
+		Message:  msg,
+		Token:    s.Source[start:s.current],
+	})
+}
+
 func (s *Scanner) addToken(Type TokenType, literal interface{}) {
 	text := s.Source[s.start:s.current]
-	s.Tokens = append(s.Tokens, Token{
+	token := Token{
 		Type:    Type,
 		Lexeme:  text,
 		Literal: literal,
-		Line:    s.line,
-	})
+		Line:    s.startLine,
+		Column:  s.startCol,
+		Start:   s.offset + s.start,
+		End:     s.offset + s.current,
+	}
+	s.kept = true
+
+	if s.keepTrivia {
+		// the trivia up to the end of the previous token's line trails it, the rest leads this one
+		split := 0
+		if n := len(s.pending); n != 0 {
+			for split < len(s.trivia) && s.trivia[split].Kind != NEWLINE {
+				split++
+			}
+			if split != 0 {
+				s.pending[n-1].Trailing = s.trivia[:split]
+			}
+		}
+		if split != len(s.trivia) {
+			token.Leading = s.trivia[split:]
+		}
+		s.trivia = nil
+	}
+
+	s.pending = append(s.pending, token)
+}
+
+// addTrivia keeps the text scanned since start for the next token, in trivia mode.
+// A run of whitespace ends up as a single trivia
+func (s *Scanner) addTrivia(kind TriviaKind) {
+	if !s.keepTrivia {
+		return
+	}
+	s.kept = true
+
+	text := s.Source[s.start:s.current]
+	if n := len(s.trivia); n != 0 && kind == WHITESPACE && s.trivia[n-1].Kind == WHITESPACE {
+		s.trivia[n-1].Text += text
+		s.trivia[n-1].End = s.offset + s.current
+		return
+	}
+	s.trivia = append(s.trivia, Trivia{Kind: kind, Text: text, Start: s.offset + s.start, End: s.offset + s.current})
 }
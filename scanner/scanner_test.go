@@ -1,198 +1,302 @@
 package scanner
 
 import (
+	"dexianta/glox/errorhandle"
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestScanner(t *testing.T) {
 	t.Run("scan brackets", func(t *testing.T) {
-		scanner := NewScanner("(){}")
+		scanner := NewScanner("(){}", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 		assert.Equal(t, tokens, []Token{
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    1,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   0,
+				Line:   1,
+				Column: 2,
+				Start:  1,
+				End:    2,
 			},
 			{
 				Type:   LEFT_BRACE,
 				Lexeme: "{",
-				Line:   0,
+				Line:   1,
+				Column: 3,
+				Start:  2,
+				End:    3,
 			},
 			{
 				Type:   RIGHT_BRACE,
 				Lexeme: "}",
-				Line:   0,
+				Line:   1,
+				Column: 4,
+				Start:  3,
+				End:    4,
 			},
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 5,
+				Start:  4,
+				End:    4,
 			},
 		})
 	})
 
 	t.Run("scan brackets with comments", func(t *testing.T) {
-		scanner := NewScanner("()//")
+		scanner := NewScanner("()//", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 		assert.Equal(t, tokens, []Token{
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    1,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   0,
+				Line:   1,
+				Column: 2,
+				Start:  1,
+				End:    2,
 			},
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 5,
+				Start:  4,
+				End:    4,
 			},
 		})
 	})
 
 	t.Run("scan brackets with comments", func(t *testing.T) {
-		scanner := NewScanner("()//()()()")
+		scanner := NewScanner("()//()()()", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 		assert.Equal(t, tokens, []Token{
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    1,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   0,
+				Line:   1,
+				Column: 2,
+				Start:  1,
+				End:    2,
 			},
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 11,
+				Start:  10,
+				End:    10,
 			},
 		})
 	})
 
 	t.Run("scan brackets with multiline comments", func(t *testing.T) {
-		scanner := NewScanner("()/*()\n()\n()*/()")
+		scanner := NewScanner("()/*()\n()\n()*/()", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 		assert.Equal(t, tokens, []Token{
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    1,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   0,
+				Line:   1,
+				Column: 2,
+				Start:  1,
+				End:    2,
 			},
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   2,
+				Line:   3,
+				Column: 5,
+				Start:  14,
+				End:    15,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   2,
+				Line:   3,
+				Column: 6,
+				Start:  15,
+				End:    16,
 			},
 			{
-				Type: EOF,
-				Line: 2,
+				Type:   EOF,
+				Line:   3,
+				Column: 7,
+				Start:  16,
+				End:    16,
 			},
 		})
 	})
 
 	t.Run("testing comments", func(t *testing.T) {
-		scanner := NewScanner("()//()()()\n()")
+		scanner := NewScanner("()//()()()\n()", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 		assert.Equal(t, tokens, []Token{
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    1,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   0,
+				Line:   1,
+				Column: 2,
+				Start:  1,
+				End:    2,
 			},
 			{
 				Type:   LEFT_PAREN,
 				Lexeme: "(",
-				Line:   1,
+				Line:   2,
+				Column: 1,
+				Start:  11,
+				End:    12,
 			},
 			{
 				Type:   RIGHT_PAREN,
 				Lexeme: ")",
-				Line:   1,
+				Line:   2,
+				Column: 2,
+				Start:  12,
+				End:    13,
 			},
 			{
-				Type: EOF,
-				Line: 1,
+				Type:   EOF,
+				Line:   2,
+				Column: 3,
+				Start:  13,
+				End:    13,
 			},
 		})
 	})
 
 	t.Run("operators", func(t *testing.T) {
-		scanner := NewScanner("+-/>=<=")
+		scanner := NewScanner("+-/>=<=", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 
 		expectedTokens := []Token{
 			{
 				Type:   PLUS,
 				Lexeme: "+",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    1,
 			},
 			{
 				Type:   MINUS,
 				Lexeme: "-",
-				Line:   0,
+				Line:   1,
+				Column: 2,
+				Start:  1,
+				End:    2,
 			},
 			{
 				Type:   SLASH,
 				Lexeme: "/",
-				Line:   0,
+				Line:   1,
+				Column: 3,
+				Start:  2,
+				End:    3,
 			},
 			{
 				Type:   GREATER_EQUAL,
 				Lexeme: ">=",
-				Line:   0,
+				Line:   1,
+				Column: 4,
+				Start:  3,
+				End:    5,
 			},
 			{
 				Type:   LESS_EQUAL,
 				Lexeme: "<=",
-				Line:   0,
+				Line:   1,
+				Column: 6,
+				Start:  5,
+				End:    7,
 			},
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 8,
+				Start:  7,
+				End:    7,
 			},
 		}
 
 		assert.Equal(t, expectedTokens, tokens)
 	})
 
+	t.Run("assignment operators", func(t *testing.T) {
+		scanner := NewScanner("+= -= *= /= ++ -- ---", errorhandle.NewReporter(""))
+		var types []TokenType
+		for _, token := range scanner.ScanTokens() {
+			types = append(types, token.Type)
+		}
+
+		assert.Equal(t, []TokenType{
+			PLUS_EQUAL, MINUS_EQUAL, STAR_EQUAL, SLASH_EQUAL, PLUS_PLUS, MINUS_MINUS, MINUS_MINUS, MINUS, EOF,
+		}, types)
+	})
+
 	t.Run("test string", func(t *testing.T) {
-		scanner := NewScanner("\"hello world\"\n//\"hello world\"")
+		scanner := NewScanner("\"hello world\"\n//\"hello world\"", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 
 		expectedToken := []Token{{
 			Type:    STRING,
 			Lexeme:  "\"hello world\"",
 			Literal: "hello world",
-			Line:    0,
+			Line:    1,
+			Column:  1,
+			Start:   0,
+			End:     13,
 		},
 			{
-				Type: EOF,
-				Line: 1,
+				Type:   EOF,
+				Line:   2,
+				Column: 16,
+				Start:  29,
+				End:    29,
 			},
 		}
 
@@ -200,18 +304,24 @@ func TestScanner(t *testing.T) {
 	})
 
 	t.Run("test number", func(t *testing.T) {
-		scanner := NewScanner("32")
+		scanner := NewScanner("32", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 
 		expectedToken := []Token{{
 			Type:    NUMBER,
 			Lexeme:  "32",
-			Literal: 32.0,
-			Line:    0,
+			Literal: int64(32),
+			Line:    1,
+			Column:  1,
+			Start:   0,
+			End:     2,
 		},
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 3,
+				Start:  2,
+				End:    2,
 			},
 		}
 
@@ -219,7 +329,7 @@ func TestScanner(t *testing.T) {
 	})
 
 	t.Run("test number, decimal number", func(t *testing.T) {
-		scanner := NewScanner("32.123")
+		scanner := NewScanner("32.123", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 
 		expectedToken := []Token{
@@ -227,11 +337,17 @@ func TestScanner(t *testing.T) {
 				Type:    NUMBER,
 				Lexeme:  "32.123",
 				Literal: 32.123,
-				Line:    0,
+				Line:    1,
+				Column:  1,
+				Start:   0,
+				End:     6,
 			},
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 7,
+				Start:  6,
+				End:    6,
 			},
 		}
 
@@ -239,7 +355,7 @@ func TestScanner(t *testing.T) {
 	})
 
 	t.Run("test number, multiple decimal number", func(t *testing.T) {
-		scanner := NewScanner("32.123 546.123")
+		scanner := NewScanner("32.123 546.123", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 
 		expectedToken := []Token{
@@ -247,84 +363,406 @@ func TestScanner(t *testing.T) {
 				Type:    NUMBER,
 				Lexeme:  "32.123",
 				Literal: 32.123,
-				Line:    0,
+				Line:    1,
+				Column:  1,
+				Start:   0,
+				End:     6,
 			},
 
 			{
 				Type:    NUMBER,
 				Lexeme:  "546.123",
 				Literal: 546.123,
-				Line:    0,
+				Line:    1,
+				Column:  8,
+				Start:   7,
+				End:     14,
 			},
 
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 15,
+				Start:  14,
+				End:    14,
 			},
 		}
 
 		assert.Equal(t, tokens, expectedToken)
 	})
 
+	t.Run("test number, other literals", func(t *testing.T) {
+		for source, literal := range map[string]interface{}{
+			"0xFF":                  int64(255),
+			"0b1010":                int64(10),
+			"1_000_000":             int64(1000000),
+			"9007199254740993":      int64(9007199254740993),
+			"1e9":                   1e9,
+			"2.5E-3":                2.5e-3,
+			"1_0.2_5":               10.25,
+			"0x7fff_ffff_ffff_ffff": int64(9223372036854775807),
+		} {
+			scanner := NewScanner(source, errorhandle.NewReporter(""))
+			tokens := scanner.ScanTokens()
+
+			assert.Equal(t, NUMBER, tokens[0].Type, source)
+			assert.Equal(t, source, tokens[0].Lexeme, source)
+			assert.Equal(t, literal, tokens[0].Literal, source)
+			assert.Equal(t, EOF, tokens[1].Type, source)
+		}
+	})
+
+	t.Run("invalid number", func(t *testing.T) {
+		for source, message := range map[string]string{
+			"1__0":                "'_' must be between digits",
+			"10_":                 "'_' must be between digits",
+			"0x_1":                "'_' must be between digits",
+			"0x":                  "Expect digits after '0x'",
+			"9223372036854775808": "Integer literal '9223372036854775808' is out of range",
+		} {
+			reporter := errorhandle.NewReporter(source)
+			scanner := NewScanner(source, reporter)
+			scanner.ScanTokens()
+
+			if assert.NotEmpty(t, reporter.Diagnostics(), source) {
+				assert.Equal(t, message, reporter.Diagnostics()[0].Message, source)
+			}
+		}
+	})
+
 	t.Run("identifier", func(t *testing.T) {
-		scanner := NewScanner("if {hello} else {world}")
+		scanner := NewScanner("if {hello} else {world}", errorhandle.NewReporter(""))
 		tokens := scanner.ScanTokens()
 
 		expectedToken := []Token{
 			{
 				Type:   IF,
 				Lexeme: "if",
-				Line:   0,
+				Line:   1,
+				Column: 1,
+				Start:  0,
+				End:    2,
 			},
 
 			{
 				Type:   LEFT_BRACE,
 				Lexeme: "{",
-				Line:   0,
+				Line:   1,
+				Column: 4,
+				Start:  3,
+				End:    4,
 			},
 
 			{
 				Type:   IDENTIFIER,
 				Lexeme: "hello",
-				Line:   0,
+				Line:   1,
+				Column: 5,
+				Start:  4,
+				End:    9,
 			},
 
 			{
 				Type:   RIGHT_BRACE,
 				Lexeme: "}",
-				Line:   0,
+				Line:   1,
+				Column: 10,
+				Start:  9,
+				End:    10,
 			},
 
 			{
 				Type:   ELSE,
 				Lexeme: "else",
-				Line:   0,
+				Line:   1,
+				Column: 12,
+				Start:  11,
+				End:    15,
 			},
 
 			{
 				Type:   LEFT_BRACE,
 				Lexeme: "{",
-				Line:   0,
+				Line:   1,
+				Column: 17,
+				Start:  16,
+				End:    17,
 			},
 
 			{
 				Type:   IDENTIFIER,
 				Lexeme: "world",
-				Line:   0,
+				Line:   1,
+				Column: 18,
+				Start:  17,
+				End:    22,
 			},
 
 			{
 				Type:   RIGHT_BRACE,
 				Lexeme: "}",
-				Line:   0,
+				Line:   1,
+				Column: 23,
+				Start:  22,
+				End:    23,
 			},
 
 			{
-				Type: EOF,
-				Line: 0,
+				Type:   EOF,
+				Line:   1,
+				Column: 24,
+				Start:  23,
+				End:    23,
 			},
 		}
 
 		assert.Equal(t, tokens, expectedToken)
 	})
+
+	t.Run("multiline string starts on its first line", func(t *testing.T) {
+		scanner := NewScanner("\n  \"a\nb\" x", errorhandle.NewReporter(""))
+		tokens := scanner.ScanTokens()
+
+		assert.Equal(t, Token{
+			Type:    STRING,
+			Lexeme:  "\"a\nb\"",
+			Literal: "a\nb",
+			Line:    2,
+			Column:  3,
+			Start:   3,
+			End:     8,
+		}, tokens[0])
+		assert.Equal(t, 3, tokens[1].Line)
+		assert.Equal(t, 4, tokens[1].Column)
+	})
+
+	t.Run("unexpected character is underlined", func(t *testing.T) {
+		source := "var a;\nvar b = @;"
+		reporter := errorhandle.NewReporter(source)
+		scanner := NewScanner(source, reporter)
+		scanner.ScanTokens()
+
+		assert.Equal(t, "[line 2:9] Error at '@' (scan): Unexpected character: @\nvar b = @;\n        ^", reporter.Err().Error())
+	})
+
+	t.Run("unicode identifiers and strings", func(t *testing.T) {
+		scanner := NewScanner("var größe = \"héllo 😀\"; 数量", errorhandle.NewReporter(""))
+		tokens := scanner.ScanTokens()
+
+		assert.Equal(t, []Token{
+			{Type: VAR, Lexeme: "var", Line: 1, Column: 1, Start: 0, End: 3},
+			{Type: IDENTIFIER, Lexeme: "größe", Line: 1, Column: 5, Start: 4, End: 11},
+			{Type: EQUAL, Lexeme: "=", Line: 1, Column: 11, Start: 12, End: 13},
+			{Type: STRING, Lexeme: "\"héllo 😀\"", Literal: "héllo 😀", Line: 1, Column: 13, Start: 14, End: 27},
+			{Type: SEMICOLON, Lexeme: ";", Line: 1, Column: 22, Start: 27, End: 28},
+			{Type: IDENTIFIER, Lexeme: "数量", Line: 1, Column: 24, Start: 29, End: 35},
+			{Type: EOF, Line: 1, Column: 26, Start: 35, End: 35},
+		}, tokens)
+	})
+
+	t.Run("unexpected unicode character", func(t *testing.T) {
+		source := "größe € 1"
+		reporter := errorhandle.NewReporter(source)
+		scanner := NewScanner(source, reporter)
+		scanner.ScanTokens()
+
+		assert.Equal(t, "[line 1:7] Error at '€' (scan): Unexpected character: €\ngröße € 1\n      ^", reporter.Err().Error())
+	})
+
+	t.Run("unterminated block comment", func(t *testing.T) {
+		scanner := NewScanner("/* *", errorhandle.NewReporter(""))
+		tokens := scanner.ScanTokens()
+
+		assert.Equal(t, []Token{{Type: EOF, Line: 1, Column: 5, Start: 4, End: 4}}, tokens)
+	})
+	t.Run("escape sequences", func(t *testing.T) {
+		scanner := NewScanner(`"a\tb\u{1F600}"`, errorhandle.NewReporter(""))
+		tokens := scanner.ScanTokens()
+
+		assert.Equal(t, []Token{
+			{Type: STRING, Lexeme: `"a\tb\u{1F600}"`, Literal: "a\tb😀", Line: 1, Column: 1, Start: 0, End: 15},
+			{Type: EOF, Line: 1, Column: 16, Start: 15, End: 15},
+		}, tokens)
+	})
+
+	t.Run("invalid escape sequence", func(t *testing.T) {
+		source := `"a\qb"`
+		reporter := errorhandle.NewReporter(source)
+		scanner := NewScanner(source, reporter)
+		scanner.ScanTokens()
+
+		if assert.Len(t, reporter.Diagnostics(), 1) {
+			assert.Equal(t, "Invalid escape sequence '\\q'", reporter.Diagnostics()[0].Message)
+		}
+	})
+
+	t.Run("string interpolation", func(t *testing.T) {
+		scanner := NewScanner(`"x ${a} y ${b + 1}!"`, errorhandle.NewReporter(""))
+		tokens := scanner.ScanTokens()
+
+		assert.Equal(t, []Token{
+			{Type: INTERPOLATION, Lexeme: `"x ${`, Literal: "x ", Line: 1, Column: 1, Start: 0, End: 5},
+			{Type: IDENTIFIER, Lexeme: "a", Line: 1, Column: 6, Start: 5, End: 6},
+			{Type: INTERPOLATION, Lexeme: "} y ${", Literal: " y ", Line: 1, Column: 7, Start: 6, End: 12},
+			{Type: IDENTIFIER, Lexeme: "b", Line: 1, Column: 13, Start: 12, End: 13},
+			{Type: PLUS, Lexeme: "+", Line: 1, Column: 15, Start: 14, End: 15},
+			{Type: NUMBER, Lexeme: "1", Literal: int64(1), Line: 1, Column: 17, Start: 16, End: 17},
+			{Type: STRING, Lexeme: `}!"`, Literal: "!", Line: 1, Column: 18, Start: 17, End: 20},
+			{Type: EOF, Line: 1, Column: 21, Start: 20, End: 20},
+		}, tokens)
+	})
+
+	t.Run("columns count characters", func(t *testing.T) {
+		source := "\"héé\" x\n\"é\\q\" y"
+		reporter := errorhandle.NewReporter(source)
+		scanner := NewScanner(source, reporter)
+		tokens := scanner.ScanTokens()
+
+		var columns []int
+		for _, token := range tokens {
+			columns = append(columns, token.Column)
+		}
+		assert.Equal(t, []int{1, 7, 1, 7, 8}, columns)
+		if assert.Len(t, reporter.Diagnostics(), 1) {
+			assert.Equal(t, 3, reporter.Diagnostics()[0].Column)
+		}
+	})
+}
+
+func TestScanner_Next(t *testing.T) {
+	source := "var größe = \"a ${b + \"c\"}\";\n/* comment\n */ print größe; // 😀\n0x_1"
+
+	t.Run("a reader gives the same tokens and diagnostics", func(t *testing.T) {
+		reporter := errorhandle.NewReporter("")
+		scanner := NewScanner(source, reporter)
+		expected := scanner.ScanTokens()
+
+		// one byte at a time splits every multi-byte character
+		streamReporter := errorhandle.NewReporter("")
+		stream := NewReaderScanner(iotest.OneByteReader(strings.NewReader(source)), streamReporter)
+		var tokens []Token
+		for {
+			token, err := stream.Next()
+			assert.Nil(t, err)
+			tokens = append(tokens, token)
+			if token.Type == EOF {
+				break
+			}
+		}
+
+		assert.Equal(t, expected, tokens)
+		assert.Equal(t, reporter.Diagnostics(), streamReporter.Diagnostics())
+	})
+
+	t.Run("a reader only keeps what's left to scan", func(t *testing.T) {
+		// text is dropped mid-line too, one long line isn't kept whole
+		for _, long := range []string{strings.Repeat(source+"\n", 500), strings.Repeat("a + ", 20000)} {
+			reporter := errorhandle.NewReporter("")
+			scanner := NewScanner(long, reporter)
+			expected := scanner.ScanTokens()
+
+			stream := NewReaderScanner(strings.NewReader(long), errorhandle.NewReporter(""))
+			var tokens []Token
+			for {
+				token, _ := stream.Next()
+				tokens = append(tokens, token)
+				if token.Type == EOF {
+					break
+				}
+			}
+
+			assert.Equal(t, expected, tokens)
+			assert.Less(t, len(stream.Source), 2*readSize)
+		}
+	})
+
+	t.Run("EOF repeats", func(t *testing.T) {
+		scanner := NewReaderScanner(strings.NewReader("1"), errorhandle.NewReporter(""))
+		scanner.Next()
+		first, _ := scanner.Next()
+		second, _ := scanner.Next()
+		assert.Equal(t, EOF, first.Type)
+		assert.Equal(t, first, second)
+	})
+
+	t.Run("read error", func(t *testing.T) {
+		failure := errors.New("disk on fire")
+		reader := io.MultiReader(strings.NewReader("print 1"), iotest.ErrReader(failure))
+		scanner := NewReaderScanner(reader, errorhandle.NewReporter(""))
+
+		token, err := scanner.Next()
+		assert.Equal(t, PRINT, token.Type)
+		assert.Nil(t, err)
+		token, err = scanner.Next()
+		assert.Equal(t, NUMBER, token.Type)
+		assert.Nil(t, err)
+		token, err = scanner.Next()
+		assert.Equal(t, EOF, token.Type)
+		assert.Equal(t, failure, err)
+	})
+}
+
+func TestScanner_Trivia(t *testing.T) {
+	source := "var a = 1; // one\n\n  /* two */ a € ;\r\n"
+
+	scanner := NewScanner(source, errorhandle.NewReporter(""))
+	scanner.KeepTrivia()
+	tokens := scanner.ScanTokens()
+
+	assert.Equal(t, []Trivia{
+		{Kind: WHITESPACE, Text: " ", Start: 10, End: 11},
+		{Kind: LINE_COMMENT, Text: "// one", Start: 11, End: 17},
+	}, tokens[4].Trailing)
+	assert.Equal(t, []Trivia{
+		{Kind: NEWLINE, Text: "\n", Start: 17, End: 18},
+		{Kind: NEWLINE, Text: "\n", Start: 18, End: 19},
+		{Kind: WHITESPACE, Text: "  ", Start: 19, End: 21},
+		{Kind: BLOCK_COMMENT, Text: "/* two */", Start: 21, End: 30},
+		{Kind: WHITESPACE, Text: " ", Start: 30, End: 31},
+	}, tokens[5].Leading)
+	assert.Equal(t, []Trivia{
+		{Kind: WHITESPACE, Text: " ", Start: 32, End: 33},
+		{Kind: SKIPPED, Text: "€", Start: 33, End: 36},
+		{Kind: WHITESPACE, Text: " ", Start: 36, End: 37},
+	}, tokens[5].Trailing)
+
+	var text string
+	for _, token := range tokens {
+		text += token.FullText()
+	}
+	assert.Equal(t, source, text)
+
+	// streaming holds a token back until its trailing trivia is known
+	stream := NewReaderScanner(iotest.OneByteReader(strings.NewReader(source)), errorhandle.NewReporter(""))
+	stream.KeepTrivia()
+	assert.Equal(t, tokens, stream.ScanTokens())
+}
+
+func TestScanner_AddOperators(t *testing.T) {
+	scanner := NewScanner("a ** b * c in d #e", errorhandle.NewReporter(""))
+	scanner.AddOperators("in", "*", "**", "#")
+	var types []TokenType
+	for _, token := range scanner.ScanTokens() {
+		types = append(types, token.Type)
+	}
+
+	assert.Equal(t, []TokenType{
+		IDENTIFIER, "**", IDENTIFIER, STAR, IDENTIFIER, "in", IDENTIFIER, "#", IDENTIFIER, EOF,
+	}, types)
+
+	// the longest match wins, whether it's added or built-in
+	scanner = NewScanner("a ~/ b ~c <=> d <= e *= f", errorhandle.NewReporter(""))
+	scanner.AddOperators("~", "<=>", "*")
+	types = nil
+	for _, token := range scanner.ScanTokens() {
+		types = append(types, token.Type)
+	}
+	assert.Equal(t, []TokenType{
+		IDENTIFIER, TILDE_SLASH, IDENTIFIER, "~", IDENTIFIER, "<=>", IDENTIFIER, LESS_EQUAL, IDENTIFIER, STAR_EQUAL, IDENTIFIER, EOF,
+	}, types)
+
+	assert.True(t, IsToken("<="))
+	assert.True(t, IsToken("and"))
+	assert.False(t, IsToken("**"))
+	assert.False(t, IsToken("in"))
 }
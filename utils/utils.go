@@ -1 +1,66 @@
 package utils
+
+import (
+	"sort"
+)
+
+// Distance is the edit distance between a and b, counting a swap of two
+// neighbouring characters as one edit since that's the most common typo
+func Distance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// Suggest picks the candidate closest to name, as long as it's close enough to be a typo.
+// Short names get no suggestion, almost anything is one edit away from them
+func Suggest(name string, candidates []string) (string, bool) {
+	maxDistance := len([]rune(name)) / 3
+	if maxDistance == 0 {
+		return "", false
+	}
+
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range sorted {
+		if candidate == name {
+			continue
+		}
+		if distance := Distance(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best, best != ""
+}
+
+func min(nums ...int) int {
+	res := nums[0]
+	for _, n := range nums[1:] {
+		if n < res {
+			res = n
+		}
+	}
+	return res
+}
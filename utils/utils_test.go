@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	assert.Equal(t, 0, Distance("fun", "fun"))
+	assert.Equal(t, 1, Distance("fucn", "fun"))
+	assert.Equal(t, 1, Distance("retrun", "return"))
+	assert.Equal(t, 3, Distance("", "abc"))
+	assert.Equal(t, 2, Distance("counter", "count"))
+}
+
+func TestSuggest(t *testing.T) {
+	suggestion, ok := Suggest("retrun", []string{"var", "return", "print"})
+	assert.True(t, ok)
+	assert.Equal(t, "return", suggestion)
+
+	_, ok = Suggest("i", []string{"if"})
+	assert.False(t, ok)
+
+	_, ok = Suggest("banana", []string{"apple"})
+	assert.False(t, ok)
+}